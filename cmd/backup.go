@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/crypto-cli/internal/backup"
+	"example.com/crypto-cli/utils"
+	"github.com/spf13/cobra"
+)
+
+// creating variables
+var backupRepo string
+var backupScheme string
+var backupPassword string
+var backupKeyfile string
+var backupKeyID string
+var backupTarget string
+var backupKeepLast int
+var backupDryRun bool
+var backupProgress bool
+var backupChunker = backup.DefaultChunkerParams
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Deduplicated, encrypted backups in a local repository",
+	Long: "Files are split with a content-defined chunker, every unique chunk is stored once,\n" +
+		"encrypted with the repository's scheme under a keyed-hash (HMAC) chunk ID, and each run\n" +
+		"is recorded in an encrypted snapshot. The repository is created by the first `backup create`.\n" +
+		"The key is a password (--password or prompt, stretched with Argon2id), a --keyfile or a --key-id.",
+}
+
+// creating cobra logic
+var backupCreateCmd = &cobra.Command{
+	Use:   "create [paths...]",
+	Short: "Back up files, directories and globs into a new snapshot",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := openBackupRepo(true)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+
+		files, err := utils.CollectFiles(args)
+		if err != nil {
+			return err
+		}
+		bar := newBackupProgress(utils.TotalSize(files), "backing up")
+		start := time.Now()
+		snap, stats, err := repo.Create(args, progressWriter(bar))
+		bar.Finish()
+		if err != nil {
+			return err
+		}
+		res := opResult{Op: "create", Input: strings.Join(args, ","), Output: backupRepo,
+			Scheme: repo.Config.Scheme, Bytes: stats.Bytes}
+		res.took(time.Since(start))
+		res.detail("snapshot", snap.ID)
+		res.detail("files", stats.Files)
+		res.detail("chunks", stats.Chunks)
+		res.detail("new_chunks", stats.NewChunks)
+		res.detail("new_bytes", stats.NewBytes)
+		var failErr error
+		if len(stats.FailedPath) > 0 {
+			res.detail("failed", stats.FailedPath)
+			failErr = withCode(codeIO, fmt.Errorf("%d file(s) could not be backed up", len(stats.FailedPath)))
+			res.finish(failErr)
+		}
+		emit(res)
+		textf("snapshot %s saved\n", snap.ID)
+		textf("%s; %d chunk(s), %d new (%s added)\n",
+			utils.ThroughputSummary(stats.Files, stats.Bytes, time.Since(start)),
+			stats.Chunks, stats.NewChunks, utils.FormatSize(stats.NewBytes))
+		if len(stats.FailedPath) > 0 {
+			fmt.Fprintf(os.Stderr, "WARNING: %d file(s) could not be backed up\n", len(stats.FailedPath))
+			return reported(failErr)
+		}
+		return nil
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <snapshot-id|latest>",
+	Short: "Restore a snapshot into a target directory",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if backupTarget == "" {
+			return withCode(codeUsage, errors.New("--target is required"))
+		}
+		repo, err := openBackupRepo(false)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+
+		snap, err := repo.LoadSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		bar := newBackupProgress(snap.Size, "restoring")
+		n, err := repo.Restore(snap, backupTarget, restoreOptions, progressWriter(bar))
+		bar.Finish()
+		res := opResult{Op: "restore", Input: backupRepo, Output: backupTarget, Scheme: repo.Config.Scheme}
+		res.detail("snapshot", snap.ID)
+		res.detail("files", n)
+		res.finish(err)
+		emit(res)
+		if err != nil {
+			textf("Error after %d file(s): %v\n", n, err)
+			return reported(err)
+		}
+		textf("restored %d file(s) from snapshot %s to %s\n", n, snap.ID, backupTarget)
+		return nil
+	},
+}
+
+// creating func to get the write options of a restored file: --overwrite and --perm
+// like any other output, otherwise the mode and mtime it was backed up with
+func restoreOptions(dest string, entry backup.FileEntry) (utils.WriteOptions, error) {
+	opts, err := outputOptions(dest, true)
+	if err != nil {
+		return opts, err
+	}
+	if !permSet {
+		opts.Perm = entry.Mode.Perm()
+	}
+	opts.ModTime = entry.ModTime
+	return opts, nil
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the snapshots in a repository",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := openBackupRepo(false)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+
+		snaps, err := repo.ListSnapshots()
+		if err != nil {
+			return err
+		}
+		for _, s := range snaps {
+			res := opResult{Op: "list", Input: backupRepo, Bytes: s.Size}
+			res.detail("snapshot", s.ID)
+			res.detail("time", s.Time)
+			res.detail("host", s.Host)
+			res.detail("files", len(s.Files))
+			res.detail("paths", s.Paths)
+			emit(res)
+			textf("%s  %s  %-12s %5d file(s) %10s  %v\n",
+				s.ID, s.Time.Local().Format("2006-01-02 15:04:05"), s.Host, len(s.Files), utils.FormatSize(s.Size), s.Paths)
+		}
+		textf("%d snapshot(s)\n", len(snaps))
+		return nil
+	},
+}
+
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune [snapshot-ids...]",
+	Short: "Forget snapshots and delete chunks no snapshot uses anymore",
+	Long: "Forget the given snapshots and, with --keep-last N, every snapshot but the newest N,\n" +
+		"then delete the chunks that no remaining snapshot refers to. --dry-run only reports.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := openBackupRepo(false)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+
+		stats, err := repo.Prune(backupKeepLast, args, backupDryRun)
+		if err != nil {
+			return err
+		}
+		verb := "removed"
+		if stats.DryRun {
+			verb = "would remove"
+		}
+		res := opResult{Op: "prune", Input: backupRepo}
+		res.detail("dry_run", stats.DryRun)
+		res.detail("snapshots", stats.Snapshots)
+		res.detail("chunks", stats.Chunks)
+		res.detail("freed_bytes", stats.FreedBytes)
+		res.detail("kept_chunks", stats.KeptChunks)
+		emit(res)
+		for _, id := range stats.Snapshots {
+			textf("%s snapshot %s\n", verb, id)
+		}
+		textf("%s %d snapshot(s) and %d chunk(s), %s freed, %d chunk(s) still in use\n",
+			verb, len(stats.Snapshots), stats.Chunks, utils.FormatSize(stats.FreedBytes), stats.KeptChunks)
+		return nil
+	},
+}
+
+// creating func to open the repository, creating it first when allowed
+func openBackupRepo(create bool) (*backup.Repository, error) {
+	if backupRepo == "" {
+		return nil, withCode(codeUsage, errors.New("--repo is required"))
+	}
+	exists := backup.Exists(backupRepo)
+	if !exists && !create {
+		return nil, withCode(codeUsage, fmt.Errorf("no repository found in %s", backupRepo))
+	}
+
+	var km backup.KeyMaterial
+	switch {
+	case backupKeyID != "":
+		k, _, err := utils.LoadKeystoreKey(keystorePath, backupKeyID)
+		if err != nil {
+			return nil, withCode(codeKey, err)
+		}
+		km.Key = append([]byte(nil), k.Bytes()...)
+		k.Destroy()
+	case backupKeyfile != "":
+		kf, err := os.ReadFile(backupKeyfile)
+		if err != nil {
+			return nil, err
+		}
+		km.Key = kf
+	default:
+		pw, err := readPasswordInput(backupPassword, !exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if err := checkPasswordPolicy(string(pw), currentPasswordPolicy()); err != nil {
+				utils.Wipe(pw)
+				return nil, withCode(codeKey, err)
+			}
+		}
+		km.Password = pw
+	}
+	defer utils.Wipe(km.Key)
+	defer utils.Wipe(km.Password)
+
+	if exists {
+		return backup.Open(backupRepo, km)
+	}
+	repo, err := backup.Init(backupRepo, backupScheme, km, backupChunker)
+	if err == nil {
+		utils.Info("created %s repository %s in %s", backupScheme, repo.Config.ID, backupRepo)
+	}
+	return repo, err
+}
+
+func newBackupProgress(total int64, desc string) *utils.Progress {
+	if !backupProgress {
+		return nil
+	}
+	return utils.NewProgress(desc, total, 0, 0)
+}
+
+func init() {
+	backupCmd.PersistentFlags().StringVar(&backupRepo, "repo", "", "Repository directory")
+	backupCmd.PersistentFlags().StringVar(&backupPassword, "password", "", "Repository password (default: prompt, or first line of stdin)")
+	backupCmd.PersistentFlags().StringVar(&backupKeyfile, "keyfile", "", "Use a keyfile as the repository key instead of a password")
+	backupCmd.PersistentFlags().StringVar(&backupKeyID, "key-id", "", "Use a keystore key as the repository key instead of a password")
+	backupCmd.PersistentFlags().BoolVar(&backupProgress, "progress", true, "Show a progress bar on stderr")
+	backupCreateCmd.Flags().StringVar(&backupScheme, "scheme", "chacha", "Encryption scheme for a new repository")
+	backupCreateCmd.Flags().IntVar(&backupChunker.Min, "chunk-min", backup.DefaultChunkerParams.Min, "Minimum chunk size for a new repository")
+	backupCreateCmd.Flags().IntVar(&backupChunker.Avg, "chunk-avg", backup.DefaultChunkerParams.Avg, "Average chunk size for a new repository (power of two)")
+	backupCreateCmd.Flags().IntVar(&backupChunker.Max, "chunk-max", backup.DefaultChunkerParams.Max, "Maximum chunk size for a new repository")
+	backupRestoreCmd.Flags().StringVar(&backupTarget, "target", "", "Directory to restore into")
+	backupPruneCmd.Flags().IntVar(&backupKeepLast, "keep-last", 0, "Keep only the newest N snapshots")
+	backupPruneCmd.Flags().BoolVar(&backupDryRun, "dry-run", false, "Only report what would be removed")
+	backupCmd.AddCommand(backupCreateCmd, backupRestoreCmd, backupListCmd, backupPruneCmd)
+}
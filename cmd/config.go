@@ -3,11 +3,11 @@ package cmd
 import (
 	"fmt"
 	"log"
-	"os"
 
 	// "log"
 
 	// "example.com/crypto-cli/utils"
+	"example.com/crypto-cli/internal/audit"
 	"example.com/crypto-cli/internal/config"
 	"example.com/crypto-cli/utils"
 	"github.com/spf13/cobra"
@@ -17,7 +17,7 @@ var configFile string
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Run encryption/decryption using a config file",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// if configFile == "" {
 		// 	fmt.Println("No config file provided.")
 		// 	return
@@ -32,50 +32,83 @@ var configCmd = &cobra.Command{
 
 		cfg, err := config.LoadConfig(cfgPath)
 		if err != nil {
-			fmt.Println("Error loading config:", err)
-			return
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		if cfg.FileTask.Mode == "encrypt" {
+			if err := checkPasswordPolicy(cfg.DefaultPassword, cfg.PasswordPolicy); err != nil {
+				return withCode(codeKey, err)
+			}
+		}
+
+		// every outcome of the task below is audited and reported,
+		// the key is named by how it was derived
+		record := func(err error) {
+			auditEvent(audit.Entry{Op: cfg.FileTask.Mode, Target: cfg.Output, Scheme: cfg.DefaultScheme,
+				KeySource: "pbkdf2-sha256 (config)", Bytes: int64(len(cfg.Input))}, err)
+			res := opResult{Op: cfg.FileTask.Mode, Input: cfgPath, Output: cfg.Output, Scheme: cfg.DefaultScheme}
+			res.finish(err)
+			emit(res)
+		}
+		fail := func(what string, err error) error {
+			record(err)
+			return emitted(fmt.Errorf("%s: %w", what, err))
 		}
 
 		// Decode salt and derive key
 		salt, err := utils.DecodeSalt(cfg.Salt)
 		if err != nil {
-			fmt.Println("Invalid salt in config:", err)
-			return
+			return withCode(codeKey, fmt.Errorf("invalid salt in config: %w", err))
 		}
-		key, err := utils.DeriveKeyWithScheme(cfg.DefaultPassword, salt, cfg.DefaultScheme)
+		pw := []byte(cfg.DefaultPassword)
+		secret, err := utils.DeriveKeyWithScheme(pw, salt, cfg.DefaultScheme)
+		utils.Wipe(pw)
 		if err != nil {
-			log.Fatalf("Key derivation failed: %v", err)
+			return fail("Key derivation failed", withCode(codeKey, err))
 		}
+		defer secret.Destroy()
+		key := secret.Bytes()
 
 		// ✅ Validate key length
 		if err := utils.ValidateKeyLength(key, cfg.DefaultScheme); err != nil {
-			fmt.Println("Key validation error:", err)
-			return
+			return withCode(codeKey, err)
 		}
 
 		switch cfg.FileTask.Mode {
 		case "encrypt":
 			cipher, err := utils.EncryptString(cfg.Input, key, cfg.DefaultScheme)
 			if err != nil {
-				log.Fatalf("Encryption failed: %v", err)
+				return fail("Encryption failed", withCode(codeCrypto, err))
+			}
+			opts, err := outputOptions(cfg.Output, false)
+			if err != nil {
+				return fail("Failed to write output file", err)
 			}
-			if err := os.WriteFile(cfg.Output, []byte(cipher), 0644); err != nil {
-				log.Fatalf("Failed to write output file: %v", err)
+			if err := utils.WriteFileAtomic(cfg.Output, []byte(cipher), opts); err != nil {
+				return fail("Failed to write output file", err)
 			}
+			record(nil)
 			log.Println("Encrypted data written to:", cfg.Output)
 		case "decrypt":
-			plain, err := utils.DecryptString(cfg.Input, key, cfg.DefaultScheme)
+			plainBytes, err := utils.DecryptString(cfg.Input, key, cfg.DefaultScheme)
+			if err != nil {
+				return fail("Decryption failed", withCode(codeCrypto, err))
+			}
+			plain := utils.NewSecretBufferFrom(plainBytes)
+			defer plain.Destroy()
+			opts, err := outputOptions(cfg.Output, true)
 			if err != nil {
-				log.Fatalf("Decryption failed: %v", err)
+				return fail("Failed to write output file", err)
 			}
-			if err := os.WriteFile(cfg.Output, plain, 0644); err != nil {
-				log.Fatalf("Failed to write output file: %v", err)
+			if err := utils.WriteFileAtomic(cfg.Output, plain.Bytes(), opts); err != nil {
+				return fail("Failed to write output file", err)
 			}
+			record(nil)
 			log.Println("Decrypted data written to:", cfg.Output)
 		default:
-			log.Fatalf("Invalid mode: %s", cfg.FileTask.Mode)
-			os.Exit(1)
+			return fail("Invalid mode", withCode(codeUsage, fmt.Errorf("unsupported mode: %s", cfg.FileTask.Mode)))
 		}
+		return nil
 	},
 }
 
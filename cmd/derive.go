@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"example.com/crypto-cli/utils"
+	"github.com/spf13/cobra"
+)
+
+// creating variables
+var deriveKey string
+var deriveKeyfile string
+var deriveContext string
+var deriveScheme string
+var derivePurpose string
+
+// creating cobra logic
+var deriveCmd = &cobra.Command{
+	Use:   "derive",
+	Short: "Derive per-context subkeys for encryption, MAC and naming from a master key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var master []byte
+		switch {
+		case deriveKeyfile != "":
+			data, err := os.ReadFile(deriveKeyfile)
+			if err != nil {
+				return fmt.Errorf("failed to read keyfile: %w", err)
+			}
+			master = data
+		case deriveKey != "":
+			key, err := decodeMasterKey(deriveKey)
+			if err != nil {
+				return err
+			}
+			master = key
+		default:
+			return withCode(codeUsage, errors.New("You must provide either --key or --keyfile"))
+		}
+		if deriveContext == "" {
+			return withCode(codeUsage, errors.New("--context is required"))
+		}
+
+		defer utils.Wipe(master)
+		if len(master) < minMasterKey {
+			return withCode(codeKey, fmt.Errorf("master key is %d bytes, at least %d are needed", len(master), minMasterKey))
+		}
+
+		sk, err := utils.DeriveSubkeys(master, deriveContext, deriveScheme)
+		if err != nil {
+			return withCode(codeKey, err)
+		}
+		subkeys := []struct {
+			purpose string
+			key     []byte
+		}{
+			{utils.PurposeEncryption, sk.Encryption},
+			{utils.PurposeMAC, sk.MAC},
+			{utils.PurposeNaming, sk.Naming},
+		}
+		res := opResult{Op: "derive", Scheme: deriveScheme}
+		res.detail("context", deriveContext)
+		for _, s := range subkeys {
+			if derivePurpose != "" && derivePurpose != s.purpose {
+				continue
+			}
+			res.detail(s.purpose, hex.EncodeToString(s.key))
+			textf("%s subkey: %s\n", s.purpose, hex.EncodeToString(s.key))
+		}
+		emit(res)
+		for _, s := range subkeys {
+			utils.Wipe(s.key)
+		}
+		return nil
+	},
+}
+
+// the shortest master key derive accepts, in bytes
+const minMasterKey = 16
+
+// creating func to decode --key the way keygen prints keys, hex or base64
+func decodeMasterKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, withCode(codeUsage, errors.New("--key must be hex or base64, as printed by keygen"))
+		}
+	}
+	return key, nil
+}
+
+func init() {
+	deriveCmd.Flags().StringVar(&deriveKey, "key", "", "Master key, hex or base64 as printed by keygen")
+	deriveCmd.Flags().StringVar(&deriveKeyfile, "keyfile", "", "Path to a keyfile holding the master key")
+	deriveCmd.Flags().StringVar(&deriveContext, "context", "", "Context to derive subkeys for (file path, tenant, ...)")
+	deriveCmd.Flags().StringVar(&deriveScheme, "scheme", "cbc", "Encryption scheme the encryption subkey is sized for: cbc, gcm or chacha")
+	deriveCmd.Flags().StringVar(&derivePurpose, "purpose", "", "Only print one subkey: enc, mac or name")
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeMasterKey(t *testing.T) {
+	want := bytes.Repeat([]byte{0xa7}, 32)
+	for _, s := range []string{hex.EncodeToString(want), base64.StdEncoding.EncodeToString(want)} {
+		got, err := decodeMasterKey(s)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x, %v", s, got, err)
+		}
+	}
+	if _, err := decodeMasterKey("not a key!"); errorCode(err) != codeUsage {
+		t.Errorf("got %v, want a usage error", err)
+	}
+}
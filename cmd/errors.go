@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"io/fs"
+
+	"example.com/crypto-cli/internal/backup"
+	"example.com/crypto-cli/utils"
+)
+
+// error codes in opResult.Code
+const (
+	codeError     = "error"        // anything not classified below
+	codeUsage     = "usage"        // bad flags or arguments
+	codeIO        = "io_error"     // a file couldn't be read or written
+	codeKey       = "key_error"    // the key couldn't be loaded, derived or validated
+	codeCrypto    = "crypto_error" // encryption or decryption failed
+	codeMismatch  = "mismatch"     // a checksum, MAC, hash or verification didn't match
+	codeAuth      = "auth_failed"  // the ciphertext didn't authenticate or unpad: wrong key or tampered data
+	codeTruncated = "truncated"    // the ciphertext is too short or malformed
+)
+
+// exit status of the process for each error code, documented in the readme.
+// mismatches keep status 1 like before, so scripts checking for 1 keep working
+var exitCodes = map[string]int{
+	codeError:     1,
+	codeCrypto:    1,
+	codeMismatch:  1,
+	codeUsage:     2,
+	codeIO:        3,
+	codeKey:       4,
+	codeAuth:      5,
+	codeTruncated: 6,
+}
+
+// an error carrying its code for the json output
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// creating func to tag an error with its json error code
+func withCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// an error that was already printed (per-file FAIL lines, json results),
+// Execute only turns it into the exit status
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string { return e.err.Error() }
+func (e *reportedError) Unwrap() error { return e.err }
+
+func reported(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &reportedError{err: err}
+}
+
+// creating func to classify an error for opResult.Code
+// the sentinel errors are more specific than the code a command tagged them with,
+// e.g. a decryption failure (crypto_error) caused by a wrong key is auth_failed
+func errorCode(err error) string {
+	var ce *codedError
+	var pe *fs.PathError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, utils.ErrAuthFailed), errors.Is(err, utils.ErrBadPadding):
+		return codeAuth
+	case errors.Is(err, utils.ErrTruncated):
+		return codeTruncated
+	case errors.Is(err, utils.ErrKeyLength), errors.Is(err, backup.ErrWrongKey):
+		return codeKey
+	case errors.Is(err, utils.ErrUnsupportedScheme):
+		return codeUsage
+	case errors.Is(err, utils.ErrExists):
+		return codeIO
+	case errors.As(err, &ce):
+		return ce.code
+	case errors.As(err, &pe):
+		return codeIO
+	}
+	return codeError
+}
+
+// creating func to map an error to the exit status of the process
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if c, ok := exitCodes[errorCode(err)]; ok {
+		return c
+	}
+	return 1
+}
+
+// creating func for an error whose json result was already emitted:
+// text mode still prints it once, json mode only sets the exit status
+func emitted(err error) error {
+	if jsonOutput() {
+		return reported(err)
+	}
+	return err
+}
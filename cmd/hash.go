@@ -1,10 +1,19 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
 
 	"example.com/crypto-cli/crypto"
+	"example.com/crypto-cli/internal/metrics"
+	"example.com/crypto-cli/utils"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // creating variables
@@ -12,48 +21,379 @@ var hashInput string
 var hashAlgo string
 var hashFile string
 var hashCompare string
+var hashHMAC bool
+var hashKeyed bool
+var hashKey string
+var hashKeyID string
+var hashVerify string
+var hashManifest string
+var hashManifestFormat string
+var hashCheck string
+var hashWorkers int
+var hashProgress bool
+var hashOutputFormat string
 
 // creating cobra logic
 var hashCmd = &cobra.Command{
-	Use:   "hash",
+	Use:   "hash [paths...]",
 	Short: "Generate a hash for both strings and files",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		var result string
 
-		if hashFile != "" {
-			result, err := crypto.HashFile(hashFile, hashAlgo)
-			if err != nil {
-				fmt.Println("Error:", err)
-				return
+		if err := utils.ValidDigestFormat(hashOutputFormat); err != nil {
+			return withCode(codeUsage, err)
+		}
+		// without --progress (or an explicit --progress-style) it follows stderr like
+		// --progress-style=auto: shown on a terminal, left out when stderr is piped or redirected
+		if !cmd.Flags().Changed("progress") {
+			hashProgress = cmd.Flags().Changed("progress-style") || term.IsTerminal(int(os.Stderr.Fd()))
+		}
+		if hashAlgo == "list" {
+			for _, name := range utils.ListHashes() {
+				h, _ := utils.GetHash(name)
+				res := opResult{Op: "list", Algorithm: name}
+				res.detail("bits", h.Size*8)
+				emit(res)
+				textf("%-12s %4d bits\n", name, h.Size*8)
 			}
-			fmt.Printf("%s file hash: %s\n", hashAlgo, result)
-			return
-		}
-		if hashInput != "" {
-			result, err := crypto.HashString(hashInput, hashAlgo)
-			if err != nil {
-				fmt.Println("Error:", err)
-				return
+			textln("blake2b-<bits>    8-512 bits")
+			textln("blake2s-<bits>    8-256 bits")
+			textln("blake3-<bits>     8-2048 bits")
+			return nil
+		}
+
+		if hashHMAC || hashKeyed {
+			return runMAC()
+		}
+
+		if hashCheck != "" {
+			// without --algo the algorithm of untagged lines is told by their digest length
+			algo := ""
+			if cmd.Flags().Changed("algo") {
+				algo = hashAlgo
 			}
-			fmt.Printf("%s hash: %s\n", hashAlgo, result)
-			return
+			return runCheck(algo)
+		}
+		if hashManifest != "" {
+			return runManifest(args)
+		}
+		// "-" reads stdin, like sha256sum. it has to be given: a cron job or CI
+		// step with nothing attached to stdin would otherwise wait on it forever
+		if len(args) == 1 && args[0] == stdioPath {
+			hashFile, args = stdioPath, nil
+		}
+		if len(args) > 0 {
+			return runMany(args)
+		}
+
+		var err error
+		var size int64
+		label := "hash"
+		start := time.Now()
+		switch {
+		case hashFile != "":
+			result, size, err = crypto.HashFileSize(hashFile, hashAlgo)
+			label = "file hash"
+		case hashInput != "":
+			result, err = crypto.HashString(hashInput, hashAlgo)
+			size = int64(len(hashInput))
+		default:
+			return withCode(codeUsage, errors.New("You must provide either --input or --file (--file - or - reads stdin)"))
+		}
+		target := hashFile
+		if hashFile == "" {
+			target = "<string>"
+		}
+		if err != nil {
+			reportHash("hash", target, "", size, time.Since(start), err)
+			return emitted(err)
 		}
 		if hashCompare != "" {
-		if result == hashCompare {
-			fmt.Println("✅ Hash matches!")
-		} else {
-			fmt.Println("❌ Hash mismatch.")
-			fmt.Printf("Expected: %s\nGot:      %s\n", hashCompare, result)
+			if !strings.EqualFold(strings.TrimSpace(hashCompare), result) {
+				err := withCode(codeMismatch, fmt.Errorf("hash mismatch, expected %s", strings.TrimSpace(hashCompare)))
+				reportHash("compare", target, result, size, time.Since(start), err)
+				textln("❌ Hash mismatch.")
+				textf("Expected: %s\nGot:      %s\n", hashCompare, result)
+				return reported(err)
+			}
+			reportHash("compare", target, result, size, time.Since(start), nil)
+			textln("✅ Hash matches!")
+			return nil
 		}
-		return
-	}
-		fmt.Println("Error: You must provide either --input or --file")
+		reportHash("hash", target, result, size, time.Since(start), nil)
+		if jsonOutput() {
+			return nil
+		}
+		if hashOutputFormat == "text" {
+			fmt.Fprintf(resultOut(), "%s %s: %s\n", hashAlgo, label, result)
+			return nil
+		}
+		printDigest(utils.NewDigestRecord(hashAlgo, hashFile, result, size, time.Since(start)))
+		return nil
 	},
 }
 
 func init() {
 	hashCmd.Flags().StringVar(&hashInput, "input", "", "Input string to hash")
-	hashCmd.Flags().StringVar(&hashAlgo, "algo", "sha256", "HAshing Algorithm: sha256, sha512, md5")
-	hashCmd.Flags().StringVar(&hashFile, "file", "", "File string to hash")
+	hashCmd.Flags().StringVar(&hashAlgo, "algo", "sha256", "Hashing algorithm ('list' to show all): "+strings.Join(utils.ListHashes(), ", ")+", blake2b-<bits>, blake2s-<bits>, blake3-<bits>")
+	hashCmd.Flags().StringVar(&hashFile, "file", "", "File to hash ('-' reads from stdin)")
 	hashCmd.Flags().StringVar(&hashCompare, "compare", "", "Compare computed hash with given hash")
+	hashCmd.Flags().BoolVar(&hashHMAC, "hmac", false, "Compute an HMAC with the selected algorithm")
+	hashCmd.Flags().BoolVar(&hashKeyed, "keyed", false, "Use the native keyed mode of blake2b, blake2s or blake3 instead of HMAC")
+	hashCmd.Flags().StringVar(&hashKey, "key", "", "Secret key for --hmac/--keyed")
+	hashCmd.Flags().StringVar(&hashKeyID, "key-id", "", "ID of a keystore key for --hmac/--keyed")
+	hashCmd.Flags().StringVar(&hashManifest, "manifest", "", "Hash the files and directories given as arguments and write a manifest here ('-' for stdout)")
+	hashCmd.Flags().StringVar(&hashManifestFormat, "manifest-format", "gnu", "Manifest format: gnu (sha256sum) or bsd (tagged)")
+	hashCmd.Flags().StringVar(&hashCheck, "check", "", "Verify every entry of a manifest (exit code 1 on any failure)")
+	hashCmd.Flags().StringVar(&hashOutputFormat, "output-format", "text", "Digest output format: "+strings.Join(utils.DigestFormats, ", "))
+	hashCmd.Flags().BoolVar(&hashProgress, "progress", false, "Show an aggregate progress bar and throughput summary on stderr (default: only when stderr is a terminal)")
+	hashCmd.Flags().IntVar(&hashWorkers, "workers", runtime.NumCPU(), "Number of files hashed in parallel")
+	hashCmd.Flags().StringVar(&hashVerify, "verify", "", "Expected MAC in hex, compared in constant time (exit code 1 on mismatch)")
+}
+
+// computing (and optionally verifying) a MAC of --input or --file
+// --file=- reads from stdin, so CI pipelines can authenticate artifacts in place
+func runMAC() error {
+	var key *utils.SecretBuffer
+	switch {
+	case hashKeyID != "":
+		var err error
+		key, _, err = utils.LoadKeystoreKey(keystorePath, hashKeyID)
+		if err != nil {
+			return withCode(codeKey, err)
+		}
+	case hashKey != "":
+		key = utils.NewSecretBufferFrom([]byte(hashKey))
+	default:
+		return withCode(codeUsage, errors.New("--hmac and --keyed need --key or --key-id"))
+	}
+	defer key.Destroy()
+
+	var mac string
+	var err error
+	target := hashFile
+	switch {
+	case hashFile != "":
+		mac, err = crypto.MACFile(hashFile, hashAlgo, key.Bytes(), hashKeyed)
+	case hashInput != "":
+		mac, err = crypto.MACString(hashInput, hashAlgo, key.Bytes(), hashKeyed)
+		target = "<string>"
+	default:
+		return withCode(codeUsage, errors.New("You must provide either --input or --file"))
+	}
+	op := "hmac"
+	if hashKeyed {
+		op = "keyed"
+	}
+	if err != nil {
+		reportHash(op, target, "", 0, 0, err)
+		return emitted(err)
+	}
+
+	kind := "hmac-" + hashAlgo
+	if hashKeyed {
+		kind = "keyed-" + hashAlgo
+	}
+	if hashVerify == "" {
+		reportHash(op, target, mac, 0, 0, nil)
+		textf("%s: %s\n", kind, mac)
+		return nil
+	}
+	if utils.VerifyMAC(hashVerify, mac) {
+		reportHash(op+"-verify", target, mac, 0, 0, nil)
+		textf("✅ %s matches!\n", kind)
+		return nil
+	}
+	err = withCode(codeMismatch, errors.New("mac mismatch"))
+	reportHash(op+"-verify", target, mac, 0, 0, err)
+	textf("❌ %s mismatch.\n", kind)
+	return reported(err)
+}
+
+// hashing every file under the given paths concurrently and writing a manifest
+func runManifest(paths []string) error {
+	if len(paths) == 0 {
+		return withCode(codeUsage, errors.New("--manifest needs at least one file or directory argument"))
+	}
+	if hashManifest == "-" && jsonOutput() {
+		return withCode(codeUsage, errors.New("--manifest=- can't share stdout with --output=json"))
+	}
+	if _, ok := utils.GetHash(hashAlgo); !ok {
+		return withCode(codeUsage, fmt.Errorf("unsupported algorithm: %s", hashAlgo))
+	}
+	var opts utils.WriteOptions
+	if hashManifest != "-" {
+		var err error
+		if opts, err = outputOptions(hashManifest, false); err != nil {
+			return err
+		}
+	}
+	files, err := utils.CollectFiles(paths)
+	if err != nil {
+		return err
+	}
+	results := hashBatch(files)
+	failed := 0
+	var firstErr error
+	for _, r := range results {
+		reportHash("hash", r.Path, r.Digest, r.Size, r.Duration, r.Err)
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.Path, r.Err)
+			failed++
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	var f *utils.AtomicFile
+	if hashManifest != "-" {
+		f, err = utils.CreateAtomic(hashManifest, opts)
+		if err != nil {
+			return err
+		}
+		defer f.Abort()
+		out = f
+	}
+	if err := utils.WriteManifest(out, hashAlgo, hashManifestFormat, results); err != nil {
+		return err
+	}
+	if f != nil {
+		if err := f.Commit(); err != nil {
+			return err
+		}
+	}
+	if hashManifest != "-" {
+		res := opResult{Op: "manifest", Output: hashManifest, Algorithm: hashAlgo}
+		res.detail("files", len(results)-failed)
+		emit(res)
+		textf("%d file(s) hashed with %s, manifest written to: %s\n", len(results)-failed, hashAlgo, hashManifest)
+	}
+	// the failed files were reported one by one above
+	return reported(firstErr)
+}
+
+// checking a manifest and reporting OK, FAILED or MISSING per file
+func runCheck(algo string) error {
+	f, err := os.Open(hashCheck)
+	if err != nil {
+		return err
+	}
+	entries, err := utils.ParseManifest(f, algo)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.Path
+	}
+	bar := newHashProgress(paths)
+	results := utils.CheckManifest(entries, hashWorkers, bar)
+	bar.Finish()
+
+	var failed, missing int
+	var firstErr error
+	for _, r := range results {
+		textf("%s: %s\n", r.Entry.Path, r.Status)
+		var checkErr error
+		switch r.Status {
+		case utils.CheckFailed:
+			failed++
+			checkErr = withCode(codeMismatch, errors.New("checksum mismatch"))
+		case utils.CheckMissing:
+			missing++
+			checkErr = withCode(codeIO, errors.New("file missing"))
+		}
+		reportHash("check", r.Entry.Path, r.Entry.Digest, 0, 0, checkErr)
+		if firstErr == nil {
+			firstErr = checkErr
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %d computed checksum(s) did NOT match\n", failed)
+	}
+	if missing > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %d listed file(s) could not be found\n", missing)
+	}
+	return reported(firstErr)
+}
+
+// hashing many files and globs on the worker pool, printed in argument order
+func runMany(patterns []string) error {
+	if _, ok := utils.GetHash(hashAlgo); !ok {
+		return withCode(codeUsage, fmt.Errorf("unsupported algorithm: %s", hashAlgo))
+	}
+	files, err := utils.CollectFiles(patterns)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, r := range hashBatch(files) {
+		reportHash("hash", r.Path, r.Digest, r.Size, r.Duration, r.Err)
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.Path, r.Err)
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+			continue
+		}
+		printDigest(utils.NewDigestRecord(hashAlgo, r.Path, r.Digest, r.Size, r.Duration))
+	}
+	return reported(firstErr)
+}
+
+// creating func to audit a hash operation and print its json result
+func reportHash(op, target, digest string, n int64, d time.Duration, err error) {
+	auditHash(op, target, n, err)
+	res := opResult{Op: op, Input: target, Algorithm: hashAlgo, Checksum: digest, Bytes: n}
+	res.took(d)
+	res.finish(err)
+	emit(res)
+}
+
+// printing one digest in --output-format, json is one object per line
+// (nothing is printed with --output=json, reportHash covers it)
+func printDigest(rec utils.DigestRecord) {
+	if jsonOutput() {
+		return
+	}
+	line, err := utils.FormatDigest(rec, hashOutputFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", rec.Path, err)
+		return
+	}
+	fmt.Fprintln(resultOut(), line)
+}
+
+// hashing files on the worker pool with the aggregate progress bar
+func hashBatch(files []string) []utils.HashResult {
+	bar := newHashProgress(files)
+	poolDone := metrics.PoolStart("hash", hashWorkers)
+	results := utils.HashFiles(files, hashAlgo, hashWorkers, bar)
+	poolDone()
+	for _, r := range results {
+		metrics.AddBusy("hash", r.Duration)
+	}
+	// Finish prints the throughput summary
+	bar.Finish()
+	return results
+}
+
+// nil (no progress) with --progress=false
+func newHashProgress(files []string) *utils.Progress {
+	if !hashProgress {
+		return nil
+	}
+	return utils.NewProgress(fmt.Sprintf("hashing %d file(s)", len(files)), utils.TotalSize(files), len(files), hashWorkers)
+}
+
+// a nil progress must become a nil io.Writer, not a typed nil
+func progressWriter(p *utils.Progress) io.Writer {
+	if p == nil {
+		return nil
+	}
+	return p
 }
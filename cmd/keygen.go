@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"example.com/crypto-cli/utils"
+	"github.com/spf13/cobra"
+)
+
+// creating variables
+var keygenScheme string
+var keygenOut string
+var keygenFormat string
+var keygenID string
+
+// creating cobra logic
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate random keys sized for the registered encryption schemes",
+	Long: "Generate CSPRNG keys for one scheme (--scheme) or for every registered scheme.\n" +
+		"Keys are printed as hex, base64 or raw bytes, can be written to a keyfile (--out)\n" +
+		"or a keystore (--id), and come with a short SHA-256 fingerprint for out-of-band checks.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schemes := utils.ListPlugins()
+		if keygenScheme != "" {
+			schemes = []string{keygenScheme}
+		}
+		if len(schemes) > 1 && (keygenOut != "" || keygenID != "") {
+			return withCode(codeUsage, errors.New("--out and --id need a single --scheme"))
+		}
+		switch keygenFormat {
+		case "hex", "base64":
+		case "raw":
+			if jsonOutput() {
+				return withCode(codeUsage, errors.New("--format=raw can't be used with --output=json"))
+			}
+			// raw keys have no separator, several of them back to back can't be told apart
+			if len(schemes) > 1 {
+				return withCode(codeUsage, errors.New("--format=raw needs a single --scheme"))
+			}
+		default:
+			return withCode(codeUsage, fmt.Errorf("unsupported format: %s", keygenFormat))
+		}
+
+		for _, name := range schemes {
+			plugin, ok := utils.GetPlugin(name)
+			if !ok {
+				return utils.UnsupportedSchemeError(name)
+			}
+			size, ok := utils.PluginKeySize(plugin)
+			if !ok {
+				return withCode(codeUsage, fmt.Errorf("scheme %s doesn't tell its key size", name))
+			}
+			raw, err := utils.GenerateKey(size)
+			if err != nil {
+				return fmt.Errorf("generating key: %w", err)
+			}
+			key := utils.NewSecretBufferFrom(raw)
+			fingerprint := utils.KeyFingerprint(key.Bytes())
+			res := opResult{Op: "keygen", Scheme: name, Bytes: int64(key.Len())}
+			res.detail("fingerprint", fingerprint)
+
+			if keygenOut != "" {
+				if err := utils.WriteKeyFile(keygenOut, key.Bytes()); err != nil {
+					key.Destroy()
+					return err
+				}
+				res.Output = keygenOut
+				textf("%s keyfile (%d bytes) written to: %s\n", name, key.Len(), keygenOut)
+			}
+			if keygenID != "" {
+				ks, err := utils.LoadKeystore(keystorePath)
+				if err == nil {
+					err = ks.Add(keygenID, name, key.Bytes())
+				}
+				if err == nil {
+					err = utils.SaveKeystore(keystorePath, ks)
+				}
+				if err != nil {
+					key.Destroy()
+					return withCode(codeKey, err)
+				}
+				res.detail("key_id", keygenID)
+				res.detail("keystore", keystorePath)
+				textf("%s key stored as %q in: %s\n", name, keygenID, keystorePath)
+			}
+			if keygenOut == "" && keygenID == "" {
+				if jsonOutput() {
+					res.detail("key", encodeKey(key.Bytes()))
+				} else {
+					printKey(name, key.Bytes())
+				}
+			}
+			emit(res)
+			// the fingerprint goes to stderr for raw output so stdout stays pipeable
+			if keygenFormat == "raw" && keygenOut == "" && keygenID == "" {
+				fmt.Fprintf(os.Stderr, "%s fingerprint: %s\n", name, fingerprint)
+			} else {
+				textf("%s fingerprint: %s\n", name, fingerprint)
+			}
+			key.Destroy()
+		}
+		return nil
+	},
+}
+
+// printing a key in the requested format
+func printKey(scheme string, key []byte) {
+	if keygenFormat == "raw" {
+		os.Stdout.Write(key)
+		return
+	}
+	fmt.Printf("%s key (%d bytes): %s\n", scheme, len(key), encodeKey(key))
+}
+
+// hex or base64 text of a key
+func encodeKey(key []byte) string {
+	if keygenFormat == "base64" {
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	return hex.EncodeToString(key)
+}
+
+func init() {
+	keygenCmd.Flags().StringVar(&keygenScheme, "scheme", "", "Encryption scheme to generate a key for (default: every registered scheme)")
+	keygenCmd.Flags().StringVar(&keygenOut, "out", "", "Write the raw key to this keyfile (mode 0600) instead of printing it")
+	keygenCmd.Flags().StringVar(&keygenFormat, "format", "hex", "Printed key format: hex, base64 or raw")
+	keygenCmd.Flags().StringVar(&keygenID, "id", "", "Store the key in the keystore under this ID")
+}
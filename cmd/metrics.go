@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"time"
+
+	"example.com/crypto-cli/internal/metrics"
+	"example.com/crypto-cli/utils"
+)
+
+// creating variables
+var metricsAddr string
+var metricsFile string
+var metricsLinger time.Duration
+
+var metricsServer *metrics.Server
+
+// creating func to turn metrics on when --metrics-addr or --metrics-file is set
+func startMetrics() error {
+	if metricsAddr == "" && metricsFile == "" {
+		return nil
+	}
+	metrics.Enable()
+	if metricsAddr == "" {
+		return nil
+	}
+	srv, err := metrics.Serve(metricsAddr)
+	if err != nil {
+		return withCode(codeUsage, err)
+	}
+	metricsServer = srv
+	utils.Info("serving metrics on http://%s/metrics", srv.Addr())
+	return nil
+}
+
+// creating func to stop the endpoint and write the textfile when the command ends
+func stopMetrics() {
+	if metricsServer != nil {
+		// a short run can end between two scrapes, --metrics-linger keeps the final values up
+		if metricsLinger > 0 {
+			utils.Info("keeping the metrics endpoint up for %s", metricsLinger)
+			time.Sleep(metricsLinger)
+		}
+		metricsServer.Close()
+		metricsServer = nil
+	}
+	if metricsFile != "" && metrics.Enabled() {
+		if err := metrics.WriteFile(metricsFile); err != nil {
+			utils.Warn("failed to write metrics to %s: %v", metricsFile, err)
+		}
+	}
+}
+
+// every operation result is counted, whatever the output format
+func observeResult(r opResult) {
+	if r.Op == "" {
+		// command-level errors (bad flags, missing keys) aren't operations
+		return
+	}
+	scheme := r.Scheme
+	if scheme == "" {
+		scheme = r.Algorithm
+	}
+	d := time.Duration(r.DurationMs * float64(time.Millisecond))
+	metrics.Observe(r.Command, r.Op, scheme, r.Code, r.Bytes, d)
+}
+
+// creating func to run a batch on the worker pool with utilization tracking
+// fn is the same as for utils.ParallelForWorkers
+func parallelWorkers(command string, n, workers int, fn func(worker, i int)) {
+	defer metrics.PoolStart(command, workers)()
+	utils.ParallelForWorkers(n, workers, func(worker, i int) {
+		done := metrics.WorkerStart(command)
+		defer done()
+		fn(worker, i)
+	})
+}
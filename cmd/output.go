@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/crypto-cli/utils"
+)
+
+// --output selects how results are printed: text for people, json for pipelines.
+// In json mode every operation prints exactly one opResult line to stdout and all
+// the human-readable text is left out; logs, warnings and progress bars go to stderr
+var outputFormat string
+
+var outputMu sync.Mutex
+
+// set when stdout carries the data of a stream (run --out -),
+// the results and text then go to stderr so they don't corrupt it
+var stdoutIsData bool
+
+// one result object per operation for --output=json
+type opResult struct {
+	Command    string         `json:"command"`
+	Op         string         `json:"op,omitempty"`
+	Input      string         `json:"input,omitempty"`
+	Output     string         `json:"output,omitempty"`
+	Scheme     string         `json:"scheme,omitempty"`
+	Algorithm  string         `json:"algorithm,omitempty"`
+	Checksum   string         `json:"checksum,omitempty"`
+	Bytes      int64          `json:"bytes,omitempty"`
+	DurationMs float64        `json:"duration_ms,omitempty"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Code       string         `json:"code,omitempty"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+// values of opResult.Status
+const (
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// creating func to pick up --output before cobra parses the flags,
+// so errors from the parsing itself (unknown command or flag) are printed as json too
+func outputFromArgs(args []string) {
+	for i, a := range args {
+		switch {
+		case a == "--":
+			return
+		case a == "--output" && i+1 < len(args):
+			outputFormat = args[i+1]
+		case strings.HasPrefix(a, "--output="):
+			outputFormat = strings.TrimPrefix(a, "--output=")
+		}
+	}
+}
+
+func jsonOutput() bool {
+	return outputFormat == "json"
+}
+
+func validOutputFormat() error {
+	switch outputFormat {
+	case "text", "json":
+		return nil
+	}
+	// run --output <path> from before --out, still taken as the output path
+	// ("-" is the data going to stdout, the same as --out -)
+	if currentCommand == "run" && outputFormat != "" {
+		if outputPath != "" {
+			return withCode(codeUsage, fmt.Errorf("--output %s and --out %s both name the output, use --out", outputFormat, outputPath))
+		}
+		if outputFormat != stdioPath {
+			utils.Warn("run --output <path> is deprecated, use --out %s (--output only takes text or json)", outputFormat)
+		}
+		outputPath = outputFormat
+		outputFormat = "text"
+		return nil
+	}
+	return withCode(codeUsage, fmt.Errorf("unknown output format: %s (choose text or json)", outputFormat))
+}
+
+// where results are printed: stdout, unless it carries stream data
+// a progress bar on screen is cleared for the line and drawn again under it
+func resultOut() io.Writer {
+	if stdoutIsData {
+		return utils.ConsoleWriter(os.Stderr)
+	}
+	return utils.ConsoleWriter(os.Stdout)
+}
+
+// printing text results, left out in json mode
+func textf(format string, args ...any) {
+	if !jsonOutput() {
+		fmt.Fprintf(resultOut(), format, args...)
+	}
+}
+
+func textln(args ...any) {
+	if !jsonOutput() {
+		fmt.Fprintln(resultOut(), args...)
+	}
+}
+
+// creating func to finish a result: status and code come from err
+func (r *opResult) finish(err error) {
+	r.Status = statusOK
+	if err != nil {
+		r.Status = statusError
+		r.Error = err.Error()
+		r.Code = errorCode(err)
+	}
+}
+
+func (r *opResult) took(d time.Duration) {
+	r.DurationMs = float64(d.Microseconds()) / 1000
+}
+
+func (r *opResult) detail(key string, value any) {
+	if r.Details == nil {
+		r.Details = map[string]any{}
+	}
+	r.Details[key] = value
+}
+
+// creating func to print a result as one json line, nothing happens in text mode
+// every result is also counted in the metrics
+func emit(r opResult) {
+	if r.Command == "" {
+		r.Command = currentCommand
+	}
+	if r.Status == "" {
+		r.Status = statusOK
+	}
+	observeResult(r)
+	if !jsonOutput() {
+		return
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	enc := json.NewEncoder(resultOut())
+	enc.SetEscapeHTML(false)
+	enc.Encode(r)
+}
+
+// creating func to report an error that stops a command:
+// "Error: ..." on stderr in text mode, an error result in json mode
+func cmdError(err error) {
+	if !jsonOutput() {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+	var r opResult
+	r.finish(err)
+	emit(r)
+}
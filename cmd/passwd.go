@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/crypto-cli/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// creating variables
+var passwdAlgo string
+var passwdInput string
+var passwdHash string
+var passwdOpts = utils.DefaultPasswordHashOptions()
+
+// creating cobra logic
+var passwdHashCmd = &cobra.Command{
+	Use:   "hash",
+	Short: "Hash a password for storage (argon2id, bcrypt, scrypt or pbkdf2-sha256)",
+	Long: "Hash a password into a PHC string such as $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>\n" +
+		"(bcrypt keeps its own $2a$ format). The password comes from --password, a terminal\n" +
+		"prompt, or the first line of stdin.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pw, err := readPasswordInput(passwdInput, true)
+		if err != nil {
+			return withCode(codeUsage, err)
+		}
+		defer utils.Wipe(pw)
+		if err := checkPasswordPolicy(string(pw), currentPasswordPolicy()); err != nil {
+			return withCode(codeKey, err)
+		}
+		encoded, err := utils.HashPassword(pw, passwdAlgo, passwdOpts)
+		if err != nil {
+			return err
+		}
+		emit(opResult{Op: "hash", Algorithm: passwdAlgo, Output: encoded})
+		textln(encoded)
+		return nil
+	},
+}
+
+var passwdVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check a password against a stored hash, exits with status 1 on mismatch",
+	Long: "Check a password against a PHC string or bcrypt hash (--hash). The algorithm and its\n" +
+		"parameters are read from the hash itself. A warning is printed when the hash is weaker\n" +
+		"than the current --algo and cost settings and should be replaced.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if passwdHash == "" {
+			return withCode(codeUsage, errors.New("--hash is required"))
+		}
+		pw, err := readPasswordInput(passwdInput, false)
+		if err != nil {
+			return withCode(codeUsage, err)
+		}
+		defer utils.Wipe(pw)
+		ok, err := utils.VerifyPassword(pw, passwdHash)
+		if err != nil {
+			return err
+		}
+		res := opResult{Op: "verify"}
+		if !ok {
+			err := withCode(codeMismatch, errors.New("password does not match"))
+			res.finish(err)
+			emit(res)
+			textln("FAILED")
+			return reported(err)
+		}
+		rehash := utils.PasswordHashNeedsRehash(passwdHash, passwdAlgo, passwdOpts)
+		res.detail("needs_rehash", rehash)
+		emit(res)
+		textln("OK")
+		if rehash {
+			utils.Warn("hash is weaker than the current %s settings, rehash it on next use", passwdAlgo)
+		}
+		return nil
+	},
+}
+
+// creating func to get the password from the flag value, a terminal prompt or stdin
+// confirm asks twice at the terminal so typos don't end up hashed
+func readPasswordInput(flagValue string, confirm bool) ([]byte, error) {
+	if flagValue != "" {
+		return []byte(flagValue), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return nil, errors.New("no password given on stdin")
+		}
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	pw, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat password: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			utils.Wipe(pw)
+			return nil, err
+		}
+		same := string(pw) == string(again)
+		utils.Wipe(again)
+		if !same {
+			utils.Wipe(pw)
+			return nil, errors.New("passwords do not match")
+		}
+	}
+	return pw, nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{passwdHashCmd, passwdVerifyCmd} {
+		c.Flags().StringVar(&passwdAlgo, "algo", "argon2id", "Password hash: "+strings.Join(utils.PasswordHashAlgorithms, ", "))
+		c.Flags().StringVar(&passwdInput, "password", "", "Password (default: prompt, or first line of stdin)")
+		c.Flags().Uint32Var(&passwdOpts.Argon2.Memory, "memory", utils.DefaultArgon2Params.Memory, "Argon2id memory in KiB")
+		c.Flags().Uint32Var(&passwdOpts.Argon2.Time, "time", utils.DefaultArgon2Params.Time, "Argon2id iterations")
+		c.Flags().Uint8Var(&passwdOpts.Argon2.Parallelism, "parallelism", utils.DefaultArgon2Params.Parallelism, "Argon2id lanes")
+		c.Flags().Uint8Var(&passwdOpts.Scrypt.LogN, "scrypt-ln", utils.DefaultScryptParams.LogN, "scrypt cost, N = 2^ln")
+		c.Flags().IntVar(&passwdOpts.Scrypt.R, "scrypt-r", utils.DefaultScryptParams.R, "scrypt block size")
+		c.Flags().IntVar(&passwdOpts.Scrypt.P, "scrypt-p", utils.DefaultScryptParams.P, "scrypt parallelism")
+		c.Flags().IntVar(&passwdOpts.PBKDF2Rounds, "iterations", utils.DefaultPBKDF2Rounds, "pbkdf2-sha256 iterations")
+		c.Flags().IntVar(&passwdOpts.BcryptCost, "cost", utils.DefaultBcryptCost, "bcrypt cost")
+	}
+	passwdVerifyCmd.Flags().StringVar(&passwdHash, "hash", "", "Stored hash to check against")
+	passwordCmd.AddCommand(passwdHashCmd)
+	passwordCmd.AddCommand(passwdVerifyCmd)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/crypto-cli/internal/config"
+	"example.com/crypto-cli/utils"
+	"github.com/spf13/cobra"
+)
+
+// creating variables
+var genWords int
+var genSeparator string
+var genRandom bool
+var genLength int
+var genCount int
+
+var passwordCmd = &cobra.Command{
+	Use:     "password",
+	Aliases: []string{"passwd"},
+	Short:   "Password and passphrase helpers",
+}
+
+// creating cobra logic
+var passwordGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a diceware passphrase or a random password",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for i := 0; i < genCount; i++ {
+			var pw string
+			var bits float64
+			var err error
+			if genRandom {
+				pw, bits, err = utils.GenerateRandomPassword(genLength)
+			} else {
+				pw, bits, err = utils.GeneratePassphrase(genWords, genSeparator)
+			}
+			if err != nil {
+				return err
+			}
+			res := opResult{Op: "generate", Output: pw}
+			res.detail("bits", bits)
+			emit(res)
+			textf("%s  (%.1f bits)\n", pw, bits)
+		}
+		return nil
+	},
+}
+
+func init() {
+	passwordGenerateCmd.Flags().IntVar(&genWords, "words", 6, "Number of diceware words in the passphrase")
+	passwordGenerateCmd.Flags().StringVar(&genSeparator, "separator", "-", "Separator between passphrase words")
+	passwordGenerateCmd.Flags().BoolVar(&genRandom, "random", false, "Generate a random character password instead of a passphrase")
+	passwordGenerateCmd.Flags().IntVar(&genLength, "length", 20, "Length of the random password")
+	passwordGenerateCmd.Flags().IntVar(&genCount, "count", 1, "Number of passwords to generate")
+	passwordCmd.AddCommand(passwordGenerateCmd)
+}
+
+// creating func to return the password policy from the loaded config, or the defaults
+func currentPasswordPolicy() config.PasswordPolicy {
+	if AppConfig != nil {
+		return AppConfig.PasswordPolicy
+	}
+	return config.DefaultPasswordPolicy()
+}
+
+// creating func to check a password against a policy
+// returns an error only when the policy action is "reject"
+func checkPasswordPolicy(pw string, policy config.PasswordPolicy) error {
+	policy = policy.WithDefaults()
+
+	var banned []string
+	if policy.BannedWordsFile != "" {
+		words, err := utils.LoadWordList(policy.BannedWordsFile)
+		if err != nil {
+			return err
+		}
+		banned = words
+	}
+
+	strength := utils.EstimatePassword(pw, banned)
+	var problems []string
+	if strength.Length < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("length %d is below the minimum of %d", strength.Length, policy.MinLength))
+	}
+	if strength.Entropy < policy.MinEntropy {
+		problems = append(problems, fmt.Sprintf("estimated entropy %.1f bits is below the minimum of %.1f", strength.Entropy, policy.MinEntropy))
+	}
+	if strength.Banned {
+		problems = append(problems, "contains a banned word")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(strength.Warnings) > 0 {
+		problems = append(problems, strength.Warnings...)
+	}
+
+	msg := "weak password: " + strings.Join(problems, "; ")
+	if policy.Action == "reject" {
+		return fmt.Errorf("%s", msg)
+	}
+	utils.Warn("%s", msg)
+	return nil
+}
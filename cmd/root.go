@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"example.com/crypto-cli/internal/config"
 	"example.com/crypto-cli/utils"
@@ -14,40 +17,132 @@ var (
 	AppConfig *config.Config
 	logfile   bool
 	LogLevel  string
+	// log output settings, see utils.LoggerOptions
+	logFormat     string
+	logPath       string
+	logMaxSizeMB  int
+	logMaxBackups int
+	// keystore used by keygen --id and --key-id lookups
+	keystorePath string
+	// name of the running command without the root, e.g. "password hash"
+	currentCommand string
+	// how progress is shown on stderr, see utils.SetProgressStyle
+	progressStyle    string
+	progressInterval time.Duration
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "Go Encrypter",
 	Short: "A CLI Tool to encrypt/decrypt strings and files",
 	Long:  "Encrypting and Decrypting strings and/or files using AES Encryption",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	// errors are returned by RunE and printed once by Execute, as text or json,
+	// without the usage text cobra would print for every failure
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		currentCommand = commandName(cmd)
+		if err := validOutputFormat(); err != nil {
+			return err
+		}
+		if err := utils.SetProgressStyle(progressStyle, progressInterval); err != nil {
+			return withCode(codeUsage, err)
+		}
+		if err := validWriteFlags(); err != nil {
+			return err
+		}
+		if err := startMetrics(); err != nil {
+			return err
+		}
+		if err := startTracing(); err != nil {
+			return err
+		}
 		if cfgPath != "" {
 			cfg, err := config.LoadConfig(cfgPath)
 			if err != nil {
-				fmt.Println("Failed to load config:", err)
-				os.Exit(1)
+				return fmt.Errorf("failed to load config: %w", err)
 			}
 			AppConfig = cfg
 		}
+		return nil
 	},
 }
 
-func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println("Error:", err)
+// runs the CLI and returns the exit status for the error class, see exitCode
+func Execute() int {
+	defer closeAuditLog()
+	defer stopMetrics()
+	defer stopTracing()
+	outputFromArgs(os.Args[1:])
+	c, err := rootCmd.ExecuteC()
+	if err == nil {
+		return 0
+	}
+	// flag and argument errors happen before PersistentPreRunE names the command
+	if currentCommand == "" {
+		currentCommand = commandName(c)
+		err = withCode(codeUsage, err)
+	}
+	var rep *reportedError
+	if !errors.As(err, &rep) {
+		cmdError(err)
 	}
+	return exitCode(err)
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgPath, "config", "", "Path to YAML configuration file")
 	rootCmd.PersistentFlags().StringVar(&LogLevel, "loglevel", "info", "Log level: debug, info, warn, error")
-	rootCmd.PersistentFlags().BoolVar(&logfile, "logfile", false, "Enable Logging to file (crypto-cli.log)")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "text", "Result format: text, or json for one JSON object per operation on stdout")
+	rootCmd.PersistentFlags().StringVar(&keystorePath, "keystore", "crypto-cli.keystore.yaml", "Path to the keystore used by --id and --key-id")
+	rootCmd.PersistentFlags().BoolVar(&logfile, "logfile", false, "Enable Logging to file (crypto-cli.log, or --logpath)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "logformat", "text", "Log format: text (colored on a terminal), json or logfmt")
+	rootCmd.PersistentFlags().StringVar(&logPath, "logpath", "", "Log file path, enables file logging (default crypto-cli.log with --logfile)")
+	rootCmd.PersistentFlags().IntVar(&logMaxSizeMB, "logmaxsize", 10, "Rotate the log file when it reaches this many MB (0 disables rotation)")
+	rootCmd.PersistentFlags().IntVar(&logMaxBackups, "logbackups", 3, "Number of rotated log files to keep")
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(hashCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(deriveCmd)
+	rootCmd.AddCommand(passwordCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.PersistentFlags().StringVar(&auditLogPath, "audit-log", "", "Append an audit entry for every run, hash and config operation to this file")
+	rootCmd.PersistentFlags().StringVar(&auditKeyID, "audit-key-id", "", "Keystore key used to HMAC-sign (and verify) audit entries")
+	rootCmd.PersistentFlags().StringVar(&auditKeyfile, "audit-keyfile", "", "Keyfile used to HMAC-sign (and verify) audit entries")
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus/OpenMetrics metrics on this address (e.g. localhost:9464) at /metrics while the command runs")
+	rootCmd.PersistentFlags().StringVar(&metricsFile, "metrics-file", "", "Write metrics in the Prometheus text format to this file at exit (for the node_exporter textfile collector)")
+	rootCmd.PersistentFlags().DurationVar(&metricsLinger, "metrics-linger", 0, "Keep the --metrics-addr endpoint up this long after the command finishes")
+	rootCmd.PersistentFlags().StringVar(&progressStyle, "progress-style", utils.ProgressAuto, "Progress on stderr: auto (bar on a terminal, log lines otherwise), bar, log or none")
+	rootCmd.PersistentFlags().DurationVar(&progressInterval, "progress-interval", 10*time.Second, "Time between two progress log lines with --progress-style=log")
+	rootCmd.PersistentFlags().StringVar(&overwritePolicy, "overwrite", utils.OverwritePrompt, "When an output file exists: never, always, or prompt (ask on a terminal, replace it when there is none)")
+	rootCmd.PersistentFlags().StringVar(&outputPerm, "perm", "", "Octal mode of output files (default 0600 for plaintext, 0644 for ciphertext; decrypted files get the original mode from the metadata)")
+	rootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "Append tracing spans (key derivation, I/O, cipher, checksum) of run as OTLP/JSON to this file")
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(auditCmd)
 	cobra.OnInitialize(initLogger)
 }
 
 func initLogger() {
-	utils.InitLogger(LogLevel, logfile)
+	opts := utils.LoggerOptions{
+		Level:      LogLevel,
+		Format:     logFormat,
+		Path:       logPath,
+		MaxSize:    int64(logMaxSizeMB) << 20,
+		MaxBackups: logMaxBackups,
+	}
+	if logfile && opts.Path == "" {
+		opts.Path = utils.DefaultLogPath
+	}
+	if err := utils.InitLoggerWithOptions(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "[ERROR] Failed to set up logging:", err)
+	}
+}
+
+// name of the running command without the root, e.g. "password hash"
+func commandName(cmd *cobra.Command) string {
+	var parts []string
+	for c := cmd; c != nil && c.HasParent(); c = c.Parent() {
+		parts = append([]string{c.Name()}, parts...)
+	}
+	return strings.Join(parts, " ")
 }
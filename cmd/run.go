@@ -1,14 +1,18 @@
 package cmd
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
-	"sync"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
+	"example.com/crypto-cli/internal/trace"
 	"example.com/crypto-cli/utils"
 	"github.com/spf13/cobra"
 )
@@ -23,75 +27,222 @@ var (
 	password   string
 	salt       string
 	outputPath string
+	keyfile    string
+	keyContext string
+	keyID      string
+	// Merkle chunk manifest options
+	merkle         bool
+	merkleChunk    int64
+	merkleAlgo     string
+	resolvedSalt   string
+	resolvedKeyDer string
+	checksumFormat string
+	runWorkers     int
 )
 
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run encryption and decryption",
-	Run: func(cmd *cobra.Command, args []string) {
-		// creating key through slice bytes
-		var k []byte
-		if password != "" {
-			var s []byte
-			var err error
-			if salt == "" {
-				s, err := utils.GenerateSalt()
-				if err != nil {
-					utils.Error("Error generating salt: %v", err)
-					return
-				}
-				utils.Info("Generated Salt (Save this for decryption): %s", utils.EncodeSalt(s))
-			} else {
-				s, err = utils.DecodeSalt(salt)
-				if err != nil {
-					utils.Error("Invalid salt: %v", err)
-					return
-				}
-			}
-			k, err = utils.DeriveKeyWithScheme(password, s, scheme)
-			if err != nil {
-				utils.Error("Key derivation failed: %v", err)
-			}
-		} else {
-			k = []byte(key)
-			if len(k) != 16 {
-				fmt.Println("Key must be exactly 16 bytes.")
-				return
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		// the root span of the run, every file gets a child span
+		ctx, span := trace.Start(cmd.Context(), "run", trace.String("mode", mode),
+			trace.String("scheme", scheme), trace.String("type", inputType), trace.Int("inputs", len(input)))
+		defer func() { span.FinishErr(err) }()
+
+		switch mode {
+		case "encrypt", "decrypt", "verify":
+		default:
+			return withCode(codeUsage, fmt.Errorf("unsupported mode: %s (choose encrypt, decrypt or verify)", mode))
+		}
+		if err := utils.ValidDigestFormat(checksumFormat); err != nil {
+			return withCode(codeUsage, err)
+		}
+		if merkle {
+			if err := utils.ValidMerkleChunkSize(merkleChunk); err != nil {
+				return withCode(codeUsage, fmt.Errorf("--chunk-size: %w", err))
 			}
 		}
+		if err := checkStreamArgs(); err != nil {
+			return err
+		}
+		if err := checkRemoveSource(); err != nil {
+			return err
+		}
+		if err := checkEncryptNames(); err != nil {
+			return err
+		}
+
+		k, err := loadKey(ctx, mode == "encrypt")
+		if err != nil {
+			return err
+		}
+		defer k.Destroy()
+		if err := setupNames(k.Bytes()); err != nil {
+			return err
+		}
+		if err := checkRemoveTargets(); err != nil {
+			return err
+		}
 
-		if inputType == "string" {
+		// every input is reported on its own, the first failure sets the exit status
+		var firstErr error
+		if streaming() {
+			prog := utils.NewProgress(fmt.Sprintf("%s stream", mode), utils.TotalSize(input), len(input), 1)
+			parallelWorkers("run", len(input), 1, func(worker, i int) {
+				if err := handleStream(ctx, input[i], mode, k.Bytes(), prog.Worker(worker)); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			})
+			prog.Finish()
+		} else if inputType == "string" {
 			for _, in := range input {
-				handleString(in, mode, k)
+				if err := handleString(in, mode, k.Bytes()); err != nil && firstErr == nil {
+					firstErr = err
+				}
 			}
 		} else {
+			workers := 1
 			if concurrent {
-				handleFilesConcurrently(input, mode, k)
+				workers = runWorkers
+			}
+			// one display for the whole batch, Finish prints the throughput summary
+			prog := utils.NewProgress(fmt.Sprintf("%s %d file(s)", mode, len(input)), utils.TotalSize(input), len(input), workers)
+			if mode == "verify" {
+				firstErr = verifyFiles(input, k.Bytes(), prog)
+			} else if concurrent {
+				firstErr = handleFilesConcurrently(ctx, input, mode, k.Bytes(), prog)
 			} else {
-				for _, file := range input {
-					handleFile(file, mode, k)
-				}
+				// one worker, so the metrics show the sequential run the same way
+				parallelWorkers("run", len(input), 1, func(worker, i int) {
+					if err := handleFile(ctx, input[i], mode, k.Bytes(), utils.Log(), prog.Worker(worker)); err != nil && firstErr == nil {
+						firstErr = err
+					}
+				})
 			}
+			prog.Finish()
 		}
+		return reported(firstErr)
 	},
 }
 
+// creating key through slice bytes, from --password (with --salt and optionally
+// --keyfile), --key-id, --keyfile or --key, in that order
+// the key lives in a SecretBuffer, the caller wipes it with Destroy.
+// encrypting applies the password policy to a new password
+func loadKey(ctx context.Context, encrypting bool) (*utils.SecretBuffer, error) {
+	// --password takes the key from the password, a --key-id next to it would be ignored
+	if password != "" && keyID != "" {
+		return nil, withCode(codeUsage, errors.New("--password and --key-id can't be used together, pick one key source"))
+	}
+	var k *utils.SecretBuffer
+	if password != "" {
+		if encrypting {
+			if err := checkPasswordPolicy(password, currentPasswordPolicy()); err != nil {
+				return nil, withCode(codeKey, err)
+			}
+		}
+		var s []byte
+		var err error
+		if salt == "" {
+			s, err = utils.GenerateSalt()
+			if err != nil {
+				return nil, withCode(codeKey, fmt.Errorf("generating salt: %w", err))
+			}
+			utils.Info("Generated Salt (Save this for decryption): %s", utils.EncodeSalt(s))
+		} else {
+			s, err = utils.DecodeSalt(salt)
+			if err != nil {
+				return nil, withCode(codeKey, fmt.Errorf("invalid salt: %w", err))
+			}
+		}
+		resolvedSalt = utils.EncodeSalt(s)
+		resolvedKeyDer = "pbkdf2-sha256"
+		pw := []byte(password)
+		_, kdf := trace.Start(ctx, "kdf")
+		if keyfile != "" {
+			resolvedKeyDer = "pbkdf2-sha256+keyfile-hkdf"
+			// two-factor mode: password and keyfile are both needed
+			var kf []byte
+			kf, err = utils.ReadKeyFile(keyfile, scheme)
+			if err != nil {
+				utils.Wipe(pw)
+				kdf.FinishErr(err)
+				return nil, withCode(codeKey, err)
+			}
+			k, err = utils.DeriveKeyWithKeyfile(pw, kf, s, scheme)
+			utils.Wipe(kf)
+		} else {
+			k, err = utils.DeriveKeyWithScheme(pw, s, scheme)
+		}
+		utils.Wipe(pw)
+		kdf.SetAttributes(trace.String("key_derivation", resolvedKeyDer))
+		kdf.FinishErr(err)
+		if err != nil {
+			return nil, withCode(codeKey, fmt.Errorf("key derivation failed: %w", err))
+		}
+	} else if keyID != "" {
+		var entry utils.KeystoreEntry
+		var err error
+		_, ks := trace.Start(ctx, "keystore.load", trace.String("key_id", keyID))
+		k, entry, err = utils.LoadKeystoreKey(keystorePath, keyID)
+		ks.FinishErr(err)
+		if err != nil {
+			return nil, withCode(codeKey, err)
+		}
+		resolvedKeyDer = "keystore:" + keyID
+		if entry.Scheme != scheme {
+			utils.Warn("key %q was generated for %s, using it with %s", keyID, entry.Scheme, scheme)
+		}
+		if err := utils.ValidateKeyLength(k.Bytes(), scheme); err != nil {
+			k.Destroy()
+			return nil, withCode(codeKey, err)
+		}
+	} else if keyfile != "" {
+		kf, err := utils.ReadKeyFile(keyfile, scheme)
+		if err != nil {
+			return nil, withCode(codeKey, err)
+		}
+		k = utils.NewSecretBufferFrom(kf)
+		resolvedKeyDer = "keyfile"
+	} else {
+		resolvedKeyDer = "raw"
+		k = utils.NewSecretBufferFrom([]byte(key))
+		if err := utils.ValidateKeyLength(k.Bytes(), scheme); err != nil {
+			k.Destroy()
+			return nil, withCode(codeKey, err)
+		}
+	}
+	return k, nil
+}
+
 // flags for encryption / decryption of files, strings and a single file
 func init() {
-	runCmd.Flags().StringVar(&mode, "mode", "encrypt", "Mode: encrypt or decrypt")
+	runCmd.Flags().StringVar(&mode, "mode", "encrypt", "Mode: encrypt, decrypt or verify (decrypt in memory and check, nothing is written)")
 	runCmd.Flags().StringVar(&scheme, "scheme", "cbc", "Encryption scheme: cbc or gcm")
-	runCmd.Flags().StringSliceVar(&input, "input", []string{}, "Input strings or file paths")
+	runCmd.Flags().StringSliceVar(&input, "input", []string{}, "Input strings or file paths ('-' streams stdin)")
 	runCmd.Flags().StringVar(&key, "key", "1234567890abcdef", "16-byte key")
 	runCmd.Flags().StringVar(&inputType, "type", "string", "Type: string or file")
 	runCmd.Flags().StringVar(&password, "password", "", "Password to derive key using PBKDF2")
+	runCmd.Flags().StringVar(&keyfile, "keyfile", "", "Path to a keyfile (combined with --password when both are set)")
+	runCmd.Flags().StringVar(&keyID, "key-id", "", "ID of a key in the keystore (see keygen --id)")
+	runCmd.Flags().StringVar(&keyContext, "context", "", "Context (file path, tenant, ...) to derive a per-context subkey for plugins that support it")
 	runCmd.Flags().StringVar(&salt, "salt", "", "Hex-encoded salt for PBKDF2 (optional for decryption)")
 	runCmd.Flags().BoolVar(&concurrent, "concurrent", false, "Enable concurrent file processing")
-	runCmd.Flags().StringVar(&outputPath, "output", "", "Optional output file path")
+	runCmd.Flags().IntVar(&runWorkers, "workers", runtime.NumCPU(), "Number of files processed in parallel with --concurrent")
+	runCmd.Flags().StringVarP(&outputPath, "out", "o", "", "Optional output file path ('-' streams to stdout, as does --output -)")
+	runCmd.Flags().StringVar(&checksumFormat, "checksum-format", "text", "Format of the .sha256 sidecar: "+strings.Join(utils.DigestFormats, ", "))
+	runCmd.Flags().BoolVar(&merkle, "merkle", false, "On encrypt, also write a chunked Merkle manifest (<file>.merkle.yaml) of the plaintext and store its root in the metadata")
+	runCmd.Flags().Int64Var(&merkleChunk, "chunk-size", utils.DefaultMerkleChunkSize, "Merkle chunk size in bytes")
+	runCmd.Flags().StringVar(&merkleAlgo, "merkle-algo", "sha256", "Hash algorithm for the Merkle tree")
+	runCmd.Flags().BoolVar(&encryptNames, "encrypt-names", false, "Encrypt file and directory names (AES-SIV) and seal the metadata; directory inputs are encrypted as trees, --out is then a directory. Pass it on decrypt too to restore the real paths")
+	runCmd.Flags().BoolVar(&removeSource, "remove-source", false, "On encrypt, shred the plaintext original once the ciphertext is written, fsynced and verified against the .sha256 checksum")
+	runCmd.Flags().IntVar(&shredPasses, "shred-passes", 1, "Random overwrite passes before --remove-source deletes the original (0 only deletes it)")
 
 }
 
 // function to encryption/decryption script logic
-func handleString(in string, mode string, key []byte) {
+// the error is also reported in the result, it is returned for the exit status
+func handleString(in string, mode string, key []byte) error {
 	var out string
 	var err error
 
@@ -118,171 +269,343 @@ func handleString(in string, mode string, key []byte) {
 	// if err != nil {
 	// 	fmt.Println("Error:", err)
 	// }
+	start := time.Now()
+	res := opResult{Op: mode, Input: "<string>", Scheme: scheme, Bytes: int64(len(in))}
+	// strings are audited by size only, never by content
+	defer func() {
+		auditRun("<string>", int64(len(in)), err)
+		res.took(time.Since(start))
+		res.finish(err)
+		emit(res)
+	}()
 	plugin, ok := utils.GetPlugin(scheme)
 	if !ok {
-		fmt.Println("Unsupported scheme:", scheme)
-		return
+		err = utils.UnsupportedSchemeError(scheme)
+		textln("Unsupported scheme:", scheme)
+		return err
+	}
+	pk, err := utils.KeyForPlugin(plugin, key, keyContext)
+	if err != nil {
+		err = withCode(codeKey, err)
+		textln("Subkey derivation failed:", err)
+		return err
 	}
+	defer pk.Destroy()
 
 	if mode == "encrypt" {
-		out, err = plugin.Encrypt([]byte(in), key)
+		out, err = plugin.Encrypt([]byte(in), pk.Bytes())
 		if err != nil {
-			fmt.Println("Error encrypting:", err)
-			return
+			err = withCode(codeCrypto, err)
+			textln("Error encrypting:", err)
+			return err
 		}
 	} else {
 		var plain []byte
-		plain, err = plugin.Decrypt(in, key)
-		if err == nil {
-			out = string(plain)
+		plain, err = plugin.Decrypt(in, pk.Bytes())
+		if err != nil {
+			err = withCode(codeCrypto, err)
 		}
+		if mode == "verify" {
+			utils.Wipe(plain)
+			if err != nil {
+				textln("FAIL: decryption failed:", err)
+				return err
+			}
+			textln("PASS")
+			return nil
+		}
+		if err != nil {
+			textln("Error decrypting:", err)
+			return err
+		}
+		secret := utils.NewSecretBufferFrom(plain)
+		defer secret.Destroy()
+		if jsonOutput() {
+			// the result line needs it as a string, there is no way around the copy
+			res.Output = string(secret.Bytes())
+			return nil
+		}
+		// written from the buffer in one piece, a string copy of the plaintext couldn't be wiped
+		line := make([]byte, 0, len("Decrypted:  ")+secret.Len()+1)
+		line = append(append(append(line, "Decrypted:  "...), secret.Bytes()...), '\n')
+		resultOut().Write(line)
+		utils.Wipe(line)
+		return nil
 	}
-	if mode == "encrypt" {
-		fmt.Println("Encrypted: ", out)
-	} else {
-		fmt.Println("Decrypted: ", out)
-	}
-
+	res.Output = out
+	textln("Encrypted: ", out)
+	return nil
 }
 
 // / function to encryption/decryption file logic
-func handleFile(path string, mode string, key []byte) {
+// log carries the structured fields of the caller (the worker ID on the concurrent path)
+// and wp the worker's progress line (nil without progress)
+// the error is also reported in the result, it is returned for the exit status
+func handleFile(ctx context.Context, path string, mode string, key []byte, log *slog.Logger, wp *utils.WorkerProgress) (opErr error) {
+	start := time.Now()
+	defer wp.Done()
+	log = log.With(utils.FieldFile, path, utils.FieldScheme, scheme)
+	ctx, span := trace.Start(ctx, "file "+mode, trace.String("file", path), trace.String("scheme", scheme))
 
-	data, err := utils.ReadFileWithProgress(path)
-	if err != nil {
-		fmt.Printf("Failed to read %s: %v\n", path, err)
-		return
-	}
-	var out string
-	plugin, ok := utils.GetPlugin(scheme)
-	if !ok {
-		fmt.Println("Unsupported scheme:", scheme)
-		return
-	}
-	if mode == "encrypt" {
-		out, err = plugin.Encrypt(data, key)
-		if err == nil {
-			checksum := utils.ComputeSHA256(data)
-			utils.WriteChecksumFile(path, checksum)
-			fmt.Println("SHA256", checksum)
+	// every return below leaves its error in opErr for the audit entry and the result
+	var data []byte
+	res := opResult{Op: mode, Input: path, Scheme: scheme}
+	defer func() {
+		auditRun(path, int64(len(data)), opErr)
+		res.Bytes = int64(len(data))
+		res.took(time.Since(start))
+		res.finish(opErr)
+		emit(res)
+		span.SetAttributes(trace.Int64("bytes", res.Bytes))
+		span.FinishErr(opErr)
+	}()
+
+	// sidecar is the path the .sha256, .meta.yaml and .merkle.yaml are named after
+	outPath, sidecar := outputPath, path
+	if encryptNames {
+		if outPath, sidecar, opErr = namedOutput(path, mode); opErr != nil {
+			textf("Failed to place the output of %s: %v\n", path, opErr)
 			return
 		}
-	} else {
-		var plain []byte
-		plain, err := plugin.Decrypt(string(data), key)
-		if err == nil {
-			original := []byte(plain)
-			newChecksum := utils.ComputeSHA256(original)
-			oldChecksum, err := utils.ReadChecksumFile(path)
-			// checking to see if the new checksum is the same as the old one
-			if err == nil && newChecksum != oldChecksum {
-				fmt.Println("WARNING: Decrypted output checksum mismatch! file match not found")
-			} else {
-				fmt.Println("DECRYPTION SUCCESSFUL: Decrypted output matches the original checksum")
-			}
-		}
-	}
-	outPath := outputPath
-	if outPath == "" {
+	} else if outPath == "" {
 		extension := ".enc"
 		if mode == "decrypt" {
 			extension = ".dec"
 		}
 		outPath = path + extension
 	}
+	// the overwrite policy is applied (and asked) before any work is done
+	opts, opErr := outputOptions(outPath, mode == "decrypt")
+	if opErr != nil {
+		textln(opErr)
+		return
+	}
 
-	utils.WriteFile(outPath, []byte(out))
-	fmt.Printf("%s: %s -> %s\n", mode, path, outPath)
-}
-
-// // creating function to handle streamed file
-func handleStreamedFile(path string, modeStr string, key []byte) {
-	// create new cipher key
-	block, err := aes.NewCipher(key)
+	_, step := trace.Start(ctx, "read")
+	data, opErr = utils.ReadFileWithProgress(path, wp)
+	step.SetAttributes(trace.Int("bytes", len(data)))
+	step.FinishErr(opErr)
+	if opErr != nil {
+		textf("Failed to read %s: %v\n", path, opErr)
+		return
+	}
+	plugin, ok := utils.GetPlugin(scheme)
+	if !ok {
+		opErr = utils.UnsupportedSchemeError(scheme)
+		textln("Unsupported scheme:", scheme)
+		return
+	}
+	_, step = trace.Start(ctx, "kdf.subkey", trace.Bool("context", keyContext != ""))
+	pk, err := utils.KeyForPlugin(plugin, key, keyContext)
+	step.FinishErr(err)
 	if err != nil {
-		fmt.Println("AES cipher init error:", err)
+		opErr = withCode(codeKey, err)
+		textln("Subkey derivation failed:", err)
 		return
 	}
+	defer pk.Destroy()
 
-	var iv []byte
-	var outPath string
-	var inFile *os.File
-	var outFile *os.File
-
-	if modeStr == "encrypt" {
-		// Generate secure random initialization vector
-		iv = make([]byte, aes.BlockSize)
-		if _, err := rand.Read(iv); err != nil {
-			fmt.Println("Failed to generate IV:", err)
-			return
-		}
-		// opening output file and write IV first
-		outPath = path + ".enc"
-		outFile, err = os.Create(outPath)
+	// plaintext (read on encrypt, produced on decrypt) is kept in a SecretBuffer
+	var out []byte
+	if mode == "encrypt" {
+		plain := utils.NewSecretBufferFrom(data)
+		defer plain.Destroy()
+		_, step = trace.Start(ctx, "encrypt")
+		enc, err := plugin.Encrypt(plain.Bytes(), pk.Bytes())
+		step.FinishErr(err)
 		if err != nil {
-			fmt.Println("Output file error:", err)
+			opErr = withCode(codeCrypto, err)
+			textln("Error encrypting:", err)
 			return
 		}
-		defer outFile.Close()
-
-		// writing to outFile
-		_, err = outFile.Write(iv)
+		_, step = trace.Start(ctx, "checksum")
+		start := time.Now()
+		checksum := utils.ComputeSHA256(plain.Bytes())
+		// the record names the file it sits next to, with encrypted names that is
+		// the encrypted name, the plaintext path would give the name away
+		recPath := path
+		if encryptNames {
+			recPath = filepath.Base(sidecar)
+		}
+		rec := utils.NewDigestRecord("sha256", recPath, checksum, int64(plain.Len()), time.Since(start))
+		err = utils.WriteChecksumRecord(sidecar, rec, checksumFormat)
+		step.FinishErr(err)
 		if err != nil {
-			fmt.Println("Failed to write IV:", err)
-			return
+			utils.Warn("failed to write checksum for %s: %v", path, err)
 		}
-		// Encrypting the rest of the file stream
-		mode := cipher.NewCBCEncrypter(block, iv)
-		err := utils.EncryptStreamToWriter(path, mode, outFile)
+		res.Checksum = checksum
+		textln("SHA256", checksum)
+		_, step = trace.Start(ctx, "metadata", trace.Bool("merkle", merkle))
+		err = writeFileMetadata(path, sidecar, plugin, plain.Bytes(), key)
+		step.FinishErr(err)
 		if err != nil {
-			fmt.Printf("Encryption failed: %v\n", err)
-			return
+			utils.Warn("failed to write metadata for %s: %v", path, err)
 		}
+		if resolvedSalt != "" {
+			res.detail("salt", resolvedSalt)
+		}
+		out = []byte(enc)
 	} else {
-		// open input file and read IV first
-		inFile, err = os.Open(path)
+		_, step = trace.Start(ctx, "decrypt")
+		plainBytes, err := decryptData(ctx, plugin, data, pk.Bytes())
+		step.FinishErr(err)
 		if err != nil {
-			fmt.Println("Input file error:", err)
+			opErr = withCode(codeCrypto, err)
+			textln("Error decrypting:", err)
 			return
 		}
-		defer inFile.Close()
-
-		iv = make([]byte, aes.BlockSize)
-		if _, err := io.ReadFull(inFile, iv); err != nil {
-			fmt.Println("Failed to read IV:", err)
-			return
+		plain := utils.NewSecretBufferFrom(plainBytes)
+		defer plain.Destroy()
+		_, step = trace.Start(ctx, "checksum")
+		newChecksum := utils.ComputeSHA256(plain.Bytes())
+		res.Checksum = newChecksum
+		// the checksum sidecar sits next to the original file, not the .enc one
+		oldChecksum, err := utils.ReadChecksumFile(strings.TrimSuffix(path, ".enc"))
+		step.Finish()
+		// checking to see if the new checksum is the same as the old one
+		if err != nil {
+			res.detail("integrity", "unchecked")
+			textln("No checksum file found, skipping integrity check")
+		} else if newChecksum != oldChecksum {
+			res.detail("integrity", "mismatch")
+			textln("WARNING: Decrypted output checksum mismatch! file match not found")
+			opErr = withCode(codeMismatch, errors.New("decrypted output does not match the original checksum"))
+			if ranges := merkleMismatches(strings.TrimSuffix(path, ".enc"), plain.Bytes(), key); len(ranges) > 0 {
+				res.detail("differs", ranges)
+				for _, r := range ranges {
+					textf("  differs: %s\n", r)
+				}
+			}
+		} else {
+			res.detail("integrity", "match")
+			textln("DECRYPTION SUCCESSFUL: Decrypted output matches the original checksum")
 		}
+		out = plain.Bytes()
+		restoreFileInfo(&opts, strings.TrimSuffix(path, ".enc"))
+	}
 
-		// Prepared output file
-		outPath = path + ".dec"
-		outFile, err = os.Create(outPath)
+	_, step = trace.Start(ctx, "write", trace.Int("bytes", len(out)))
+	err = utils.WriteFileAtomic(outPath, out, opts)
+	step.FinishErr(err)
+	if err != nil {
+		opErr = err
+		textf("Failed to write %s: %v\n", outPath, err)
+		return
+	}
+	res.Output = outPath
+	textf("%s: %s -> %s\n", mode, path, outPath)
+	if removeSource && mode == "encrypt" {
+		_, step = trace.Start(ctx, "remove-source", trace.Int("passes", shredPasses))
+		err = removeSourceFile(ctx, path, sidecar, outPath, plugin, pk.Bytes(), &res)
+		step.FinishErr(err)
 		if err != nil {
-			fmt.Println("Failed to create output file:", err)
+			opErr = err
+			textln("WARNING:", err)
 			return
 		}
-		defer outFile.Close()
+	}
+	log.Debug(mode+" done", "output", outPath, utils.FieldBytes, len(data), utils.FieldDuration, time.Since(start))
+	return opErr
+}
 
-		// Decrypt the rest of the stream
-		mode := cipher.NewCBCDecrypter(block, iv)
-		err := utils.DecryptStreamFromReader(inFile, outFile, mode)
+// creating func to describe how the key was obtained, for the metadata file
+func keyDerivationLabel(plugin utils.Plugin) string {
+	label := resolvedKeyDer
+	if sp, ok := plugin.(utils.SubkeyPlugin); ok && sp.UsesSubkeys() && keyContext != "" {
+		label += "+hkdf-subkey"
+	}
+	return label
+}
+
+// creating func to write <sidecar>.meta.yaml, plus the Merkle manifest when --merkle is set
+// path is the original file, sidecar is path itself unless names are encrypted
+// (the metadata is then sealed with the naming key). the manifest is keyed with
+// a subkey of master, it sits next to the ciphertext
+func writeFileMetadata(path, sidecar string, plugin utils.Plugin, plain, master []byte) error {
+	meta := utils.Metadata{
+		OriginalFilename: filepath.Base(path),
+		Scheme:           plugin.Name(),
+		KeyDerivation:    keyDerivationLabel(plugin),
+		Salt:             resolvedSalt,
+		Timestamp:        time.Now().UTC(),
+	}
+	if info, err := os.Stat(path); err == nil {
+		meta.SetFileInfo(info)
+	}
+	if merkle {
+		mk, err := merkleKey(master)
 		if err != nil {
-			fmt.Printf("Encryption failed: %v\n", err)
-			return
+			return err
+		}
+		defer utils.Wipe(mk)
+		tree, err := utils.BuildMerkleTree(bytes.NewReader(plain), merkleChunk, merkleAlgo, mk)
+		if err != nil {
+			return err
+		}
+		if err := utils.WriteMerkleFile(sidecar, tree); err != nil {
+			return err
+		}
+		meta.MerkleRoot = tree.Root
+		meta.MerkleAlgo = tree.Algo
+		meta.MerkleChunkSize = tree.ChunkSize
+		textf("Merkle root (%d chunks): %s\n", len(tree.Leaves), tree.Root)
+	}
+	if encryptNames {
+		meta.OriginalPath = nameTargets[path].rel
+		name, err := encryptedRel(path)
+		if err != nil {
+			return err
 		}
+		sealed, err := meta.Seal(nameCipher, name)
+		if err != nil {
+			return err
+		}
+		meta = sealed
 	}
+	return utils.WriteMetadataFile(sidecar, meta)
+}
+
+// creating func to derive the key of the Merkle leaves from the master key
+func merkleKey(master []byte) ([]byte, error) {
+	return utils.DeriveSubkey(master, utils.PurposeMerkle, keyContext, scheme, 32)
+}
+
+// when a decrypted file doesn't match its checksum, use the Merkle manifest
+// (if there is one) to say which byte ranges differ
+func merkleMismatches(origPath string, plain, master []byte) []string {
+	tree, err := utils.LoadMerkleFile(origPath + ".merkle.yaml")
+	if err != nil {
+		return nil
+	}
+	mk, err := merkleKey(master)
+	if err != nil {
+		return nil
+	}
+	defer utils.Wipe(mk)
+	tree.SetKey(mk)
+	bad, err := tree.Verify(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		return nil
+	}
+	ranges := make([]string, len(bad))
+	for i, r := range bad {
+		ranges[i] = r.String()
+	}
+	return ranges
 }
 
 // func for encryption/ decryption of multiple files concurrently
-// using waitGroup for concurrency
-func handleFilesConcurrently(paths []string, mode string, key []byte) {
-	var wg sync.WaitGroup
-	for _, file := range paths {
-		wg.Add(1)
-		go func(f string) {
-			defer wg.Done()
-			handleFile(f, mode, key)
-			handleStreamedFile(f, mode, key)
-		}(file)
+// files go through the same handleFile as the sequential path, on at most --workers goroutines
+// the first failure in input order is returned
+func handleFilesConcurrently(ctx context.Context, paths []string, mode string, key []byte, prog *utils.Progress) error {
+	errs := make([]error, len(paths))
+	parallelWorkers("run", len(paths), runWorkers, func(worker, i int) {
+		errs[i] = handleFile(ctx, paths[i], mode, key, utils.Log().With(utils.FieldWorker, worker), prog.Worker(worker))
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
-	wg.Wait()
+	return nil
 }
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/crypto-cli/crypto"
+	"example.com/crypto-cli/utils"
+)
+
+// creating variables
+var encryptNames bool
+
+// AES-SIV keyed with the naming subkey, set up by setupNames
+var nameCipher *crypto.SIV
+
+// where an input sits: the directory given as --input (empty for a file given
+// directly) and its path below it, / separated
+type nameTarget struct {
+	root string
+	rel  string
+}
+
+var nameTargets map[string]nameTarget
+
+// creating func to check --encrypt-names before any key work is done
+func checkEncryptNames() error {
+	if !encryptNames {
+		return nil
+	}
+	if inputType != "file" || streaming() {
+		return withCode(codeUsage, errors.New("--encrypt-names only works with --type=file and file outputs"))
+	}
+	return nil
+}
+
+// creating func to derive the naming key and expand directory inputs into
+// their files: every file on encrypt, the .enc files on decrypt and verify
+func setupNames(master []byte) error {
+	if !encryptNames {
+		return nil
+	}
+	key, err := utils.DeriveSubkey(master, utils.PurposeNaming, keyContext, scheme, 64)
+	if err != nil {
+		return withCode(codeKey, err)
+	}
+	nameCipher, err = crypto.NewSIV(key)
+	utils.Wipe(key)
+	if err != nil {
+		return withCode(codeKey, err)
+	}
+
+	nameTargets = make(map[string]nameTarget)
+	var files []string
+	for _, in := range input {
+		info, err := os.Stat(in)
+		if err != nil || !info.IsDir() {
+			// unreadable inputs are reported per file
+			nameTargets[in] = nameTarget{rel: filepath.Base(in)}
+			files = append(files, in)
+			continue
+		}
+		root := filepath.Clean(in)
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() || (mode != "encrypt" && !strings.HasSuffix(path, ".enc")) {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			nameTargets[path] = nameTarget{root: root, rel: filepath.ToSlash(rel)}
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	input = files
+	// every input of one root has to get its own output, a/x.txt and b/x.txt
+	// with one --out would otherwise encrypt to the same name
+	if mode != "verify" {
+		if _, err := plannedOutputs(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// creating func to place the output of path with encrypted names
+// encrypt: <out>/<encrypted rel path>.enc with its sidecars named after it;
+// decrypt: the names are decrypted and the real path is restored under <out>.
+// <out> is --out (a directory here), else <dir>.enc / .dec for a
+// directory input (tree.enc decrypts to tree.dec) and the file's own directory for a file
+func namedOutput(path, mode string) (outPath, sidecar string, err error) {
+	outPath, sidecar, err = namedPaths(path, mode)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return "", "", err
+	}
+	return outPath, sidecar, nil
+}
+
+// the paths of namedOutput, without creating the directories
+func namedPaths(path, mode string) (outPath, sidecar string, err error) {
+	t, ok := nameTargets[path]
+	if !ok {
+		t = nameTarget{rel: filepath.Base(path)}
+	}
+	root := outputPath
+	if root == "" {
+		root = filepath.Dir(path)
+		if t.root != "" {
+			root = t.root + ".enc"
+			if mode == "decrypt" {
+				root = strings.TrimSuffix(t.root, ".enc") + ".dec"
+			}
+		}
+	}
+	if mode == "encrypt" {
+		enc, err := crypto.EncryptPath(nameCipher, t.rel)
+		if err != nil {
+			return "", "", withCode(codeUsage, err)
+		}
+		sidecar = filepath.Join(root, filepath.FromSlash(enc))
+		outPath = sidecar + ".enc"
+	} else {
+		plain, err := crypto.DecryptPath(nameCipher, strings.TrimSuffix(t.rel, ".enc"))
+		if err != nil {
+			return "", "", fmt.Errorf("decrypting the name: %w", err)
+		}
+		outPath = filepath.Join(root, filepath.FromSlash(plain))
+		sidecar = strings.TrimSuffix(path, ".enc")
+	}
+	return outPath, sidecar, nil
+}
+
+// creating func to work out the output of every input before anything is written
+// two inputs with the same output are refused, the second would replace the first
+// (and with --remove-source the first source is already shredded by then)
+func plannedOutputs() (map[string]string, error) {
+	outs := make(map[string]string, len(input))
+	seen := make(map[string]string, len(input))
+	for _, in := range input {
+		out := outputPath
+		if encryptNames {
+			var err error
+			if out, _, err = namedPaths(in, mode); err != nil {
+				// a name that doesn't decrypt is reported with its file
+				continue
+			}
+		} else if out == "" {
+			extension := ".enc"
+			if mode == "decrypt" {
+				extension = ".dec"
+			}
+			out = in + extension
+		}
+		key, err := filepath.Abs(out)
+		if err != nil {
+			key = filepath.Clean(out)
+		}
+		if prev, ok := seen[key]; ok {
+			return nil, withCode(codeUsage, fmt.Errorf("%s and %s would both be written to %s", prev, in, out))
+		}
+		seen[key] = in
+		outs[in] = out
+	}
+	return outs, nil
+}
+
+// creating func to load the metadata next to origPath, unsealed when names are encrypted
+func loadMetadata(origPath string) (utils.Metadata, error) {
+	meta, err := utils.LoadMetadataFile(origPath)
+	if err != nil || meta.Sealed == "" || nameCipher == nil {
+		return meta, err
+	}
+	name, err := encryptedRel(origPath + ".enc")
+	if err != nil {
+		return meta, err
+	}
+	return meta.Unseal(nameCipher, name)
+}
+
+// creating func to give the encrypted path of a file below its tree (without
+// .enc), the name its sealed metadata is bound to. path is the input of the run
+func encryptedRel(path string) (string, error) {
+	t, ok := nameTargets[path]
+	if !ok {
+		t = nameTarget{rel: filepath.Base(path)}
+	}
+	if mode == "encrypt" {
+		return crypto.EncryptPath(nameCipher, t.rel)
+	}
+	return strings.TrimSuffix(t.rel, ".enc"), nil
+}
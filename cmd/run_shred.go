@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/crypto-cli/utils"
+)
+
+// creating variables
+var removeSource bool
+var shredPasses int
+
+// creating func to check --remove-source before any file is touched
+func checkRemoveSource() error {
+	if !removeSource {
+		return nil
+	}
+	if mode != "encrypt" || inputType != "file" || streaming() {
+		return withCode(codeUsage, errors.New("--remove-source only works with --mode=encrypt --type=file and a file output"))
+	}
+	if shredPasses < 0 {
+		return withCode(codeUsage, errors.New("--shred-passes can't be negative"))
+	}
+	return nil
+}
+
+// creating func to check where every source's ciphertext goes, once the
+// inputs are expanded and (with --encrypt-names) the names can be worked out:
+// a source is only shredded when its ciphertext is its own and not the source itself
+func checkRemoveTargets() error {
+	if !removeSource {
+		return nil
+	}
+	// one output for two sources would keep only the last ciphertext, yet
+	// every source would verify against it in turn and be shredded
+	outs, err := plannedOutputs()
+	if err != nil {
+		return withCode(codeUsage, fmt.Errorf("--remove-source: %w", err))
+	}
+	for _, in := range input {
+		if out, ok := outs[in]; ok && samePath(in, out) {
+			return withCode(codeUsage, fmt.Errorf("--remove-source: %s is the input itself, shredding it would destroy the only copy", out))
+		}
+	}
+	return nil
+}
+
+// creating func to tell whether a and b name the same file, also when b doesn't exist yet
+func samePath(a, b string) bool {
+	ai, aerr := os.Stat(a)
+	bi, berr := os.Stat(b)
+	if aerr == nil && berr == nil {
+		return os.SameFile(ai, bi)
+	}
+	aa, aerr := filepath.Abs(a)
+	ba, berr := filepath.Abs(b)
+	return aerr == nil && berr == nil && aa == ba
+}
+
+// creating func to shred the plaintext original once its ciphertext is known good:
+// outPath (already written and fsynced) is read back, decrypted and compared
+// with the .sha256 sidecar (named after sidecar). any doubt keeps the original
+func removeSourceFile(ctx context.Context, path, sidecar, outPath string, plugin utils.Plugin, key []byte, res *opResult) error {
+	// the ciphertext replaced the source (or is a link to it), it is the only copy
+	if samePath(path, outPath) {
+		return withCode(codeUsage, fmt.Errorf("source kept, %s is the same file as its ciphertext %s", path, outPath))
+	}
+	want, err := utils.ReadChecksumFile(sidecar)
+	if err != nil {
+		return fmt.Errorf("source kept, no checksum to verify the ciphertext against: %w", err)
+	}
+	data, err := utils.ReadFile(outPath)
+	if err != nil {
+		return fmt.Errorf("source kept, can't read the ciphertext back: %w", err)
+	}
+	plain, err := decryptData(ctx, plugin, data, key)
+	if err != nil {
+		return withCode(codeCrypto, fmt.Errorf("source kept, the ciphertext doesn't decrypt: %w", err))
+	}
+	got := utils.ComputeSHA256(plain)
+	utils.Wipe(plain)
+	if !strings.EqualFold(strings.TrimSpace(want), got) {
+		return withCode(codeMismatch, errors.New("source kept, the decrypted ciphertext doesn't match the checksum"))
+	}
+
+	caveats := utils.ShredCaveats(path)
+	if err := utils.ShredFile(path, shredPasses); err != nil {
+		return fmt.Errorf("ciphertext verified but the source could not be removed: %w", err)
+	}
+	res.detail("source", "removed")
+	res.detail("shred_passes", shredPasses)
+	if len(caveats) > 0 {
+		res.detail("shred_caveats", caveats)
+	}
+	textf("removed %s after verifying %s (%d overwrite pass(es))\n", path, outPath, shredPasses)
+	for _, c := range caveats {
+		utils.Warn("%s: %s", path, c)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/crypto-cli/plugins"
+	"example.com/crypto-cli/utils"
+)
+
+// creating func to set the run flags the --remove-source checks look at, restored after the test
+func setRemoveSourceFlags(t *testing.T, in []string, out string, names bool) {
+	t.Helper()
+	rs, m, it, in0, out0, en, sp := removeSource, mode, inputType, input, outputPath, encryptNames, shredPasses
+	nc, nt := nameCipher, nameTargets
+	t.Cleanup(func() {
+		removeSource, mode, inputType, input, outputPath, encryptNames, shredPasses = rs, m, it, in0, out0, en, sp
+		nameCipher, nameTargets = nc, nt
+	})
+	removeSource, mode, inputType = true, "encrypt", "file"
+	input, outputPath, encryptNames, shredPasses = in, out, names, 1
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckRemoveSource(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	writeTestFile(t, a, "a")
+	writeTestFile(t, b, "b")
+	for _, sub := range []string{"one", "two"} {
+		os.Mkdir(filepath.Join(dir, sub), 0755)
+		writeTestFile(t, filepath.Join(dir, sub, "x.txt"), sub)
+	}
+	link := filepath.Join(dir, "a.link")
+	if err := os.Link(a, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		in    []string
+		out   string
+		names bool
+		ok    bool
+	}{
+		{"default outputs", []string{a, b}, "", false, true},
+		{"one input, own --out", []string{a}, filepath.Join(dir, "a.enc"), false, true},
+		{"one --out for two inputs", []string{a, b}, filepath.Join(dir, "both.enc"), false, false},
+		{"--out is the input", []string{a}, a, false, false},
+		{"--out is the input, spelled differently", []string{a}, dir + "/./a.txt", false, false},
+		{"--out is a hard link to the input", []string{a}, link, false, false},
+		{"--out not written yet but the same path", []string{filepath.Join(dir, "new")}, dir + "/../" + filepath.Base(dir) + "/new", false, false},
+		// with encrypted names --out is a directory, files are named by their base name in it
+		{"--encrypt-names directory", []string{a, b}, filepath.Join(dir, "vault"), true, true},
+		{"--encrypt-names, same base name", []string{filepath.Join(dir, "one", "x.txt"), filepath.Join(dir, "two", "x.txt")}, filepath.Join(dir, "vault"), true, false},
+		{"--encrypt-names, own directories", []string{filepath.Join(dir, "one", "x.txt"), filepath.Join(dir, "two", "x.txt")}, "", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRemoveSourceFlags(t, tt.in, tt.out, tt.names)
+			// the same order as run: flags, then the names, then the targets
+			err := checkRemoveSource()
+			if err == nil {
+				err = setupNames(bytes.Repeat([]byte{1}, 32))
+			}
+			if err == nil {
+				err = checkRemoveTargets()
+			}
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && errorCode(err) != codeUsage {
+				t.Fatalf("got %v, want a usage error", err)
+			}
+		})
+	}
+
+	setRemoveSourceFlags(t, []string{a}, "", false)
+	mode = "decrypt"
+	if err := checkRemoveSource(); errorCode(err) != codeUsage {
+		t.Errorf("decrypt: got %v, want a usage error", err)
+	}
+	mode, shredPasses = "encrypt", -1
+	if err := checkRemoveSource(); errorCode(err) != codeUsage {
+		t.Errorf("negative --shred-passes: got %v, want a usage error", err)
+	}
+	removeSource = false
+	mode = "decrypt"
+	if err := checkRemoveSource(); err != nil {
+		t.Errorf("without --remove-source: %v", err)
+	}
+}
+
+// creating func to encrypt src with CBC to out and write its checksum sidecar
+func encryptForShred(t *testing.T, src, out string, key []byte) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := plugins.CBCPlugin{}.Encrypt(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, out, enc)
+	if err := utils.WriteChecksumFile(src, utils.ComputeSHA256(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveSourceFile(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	plugin := plugins.CBCPlugin{}
+	setRemoveSourceFlags(t, nil, "", false)
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	t.Run("verified ciphertext", func(t *testing.T) {
+		dir := t.TempDir()
+		src, out := filepath.Join(dir, "plain.txt"), filepath.Join(dir, "plain.txt.enc")
+		writeTestFile(t, src, "the only copy")
+		encryptForShred(t, src, out, key)
+		if err := removeSourceFile(context.Background(), src, src, out, plugin, key, &opResult{}); err != nil {
+			t.Fatal(err)
+		}
+		if exists(src) {
+			t.Error("source still there after a verified encryption")
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		dir := t.TempDir()
+		src, out := filepath.Join(dir, "plain.txt"), filepath.Join(dir, "plain.txt.enc")
+		writeTestFile(t, src, "the only copy")
+		encryptForShred(t, src, out, key)
+		if err := utils.WriteChecksumFile(src, utils.ComputeSHA256([]byte("something else"))); err != nil {
+			t.Fatal(err)
+		}
+		err := removeSourceFile(context.Background(), src, src, out, plugin, key, &opResult{})
+		if errorCode(err) != codeMismatch {
+			t.Errorf("got %v, want a mismatch error", err)
+		}
+		if !exists(src) {
+			t.Error("source removed although the ciphertext didn't verify")
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		dir := t.TempDir()
+		src, out := filepath.Join(dir, "plain.txt"), filepath.Join(dir, "plain.txt.enc")
+		writeTestFile(t, src, "the only copy")
+		encryptForShred(t, src, out, key)
+		if err := removeSourceFile(context.Background(), src, src, out, plugin, []byte("fedcba9876543210"), &opResult{}); err == nil {
+			t.Error("source removed with a ciphertext that doesn't decrypt")
+		}
+		if !exists(src) {
+			t.Error("source removed although the ciphertext didn't decrypt")
+		}
+	})
+
+	t.Run("no sidecar", func(t *testing.T) {
+		dir := t.TempDir()
+		src, out := filepath.Join(dir, "plain.txt"), filepath.Join(dir, "plain.txt.enc")
+		writeTestFile(t, src, "the only copy")
+		encryptForShred(t, src, out, key)
+		os.Remove(src + ".sha256")
+		if err := removeSourceFile(context.Background(), src, src, out, plugin, key, &opResult{}); err == nil {
+			t.Error("source removed without a checksum to verify against")
+		}
+		if !exists(src) {
+			t.Error("source removed without a checksum")
+		}
+	})
+
+	t.Run("ciphertext is the source", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "plain.txt")
+		writeTestFile(t, src, "the only copy")
+		encryptForShred(t, src, src, key)
+		err := removeSourceFile(context.Background(), src, src, src, plugin, key, &opResult{})
+		if errorCode(err) != codeUsage {
+			t.Errorf("got %v, want a usage error", err)
+		}
+		if !exists(src) {
+			t.Error("the only copy was shredded")
+		}
+	})
+}
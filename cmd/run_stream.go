@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/crypto-cli/internal/trace"
+	"example.com/crypto-cli/utils"
+)
+
+// "-" as an --input or --out path stands for stdin / stdout
+const stdioPath = "-"
+
+// creating func to tell whether run streams: stdin as input or stdout as output
+func streaming() bool {
+	if outputPath == stdioPath {
+		return true
+	}
+	for _, in := range input {
+		if in == stdioPath {
+			return true
+		}
+	}
+	return false
+}
+
+// creating func to check the inputs of a streaming run before any key work is done
+// stdin is only read when --input - says so, an empty stdin of a cron job or CI
+// step would otherwise block the run
+func checkStreamArgs() error {
+	if len(input) == 0 {
+		return withCode(codeUsage, errors.New("no input given (--input <strings or files>, or --input - for stdin)"))
+	}
+	if !streaming() {
+		return nil
+	}
+	stdin := 0
+	for _, in := range input {
+		if in == stdioPath {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		return withCode(codeUsage, errors.New("stdin (-) can only be given once as --input"))
+	}
+	if outputPath == stdioPath && len(input) > 1 {
+		return withCode(codeUsage, errors.New("--out - takes exactly one input"))
+	}
+	plugin, ok := utils.GetPlugin(scheme)
+	if !ok {
+		return utils.UnsupportedSchemeError(scheme)
+	}
+	if _, ok := plugin.(utils.StreamPlugin); !ok {
+		return withCode(codeUsage, fmt.Errorf("scheme %s can't stream, stdin/stdout need one of the streaming schemes", scheme))
+	}
+	if outputPath == stdioPath || (outputPath == "" && stdin > 0 && mode != "verify") {
+		// the data owns stdout, results and messages move to stderr
+		stdoutIsData = true
+	}
+	return nil
+}
+
+// creating func to encrypt, decrypt or verify one input through the plugin's stream
+// functions, in constant memory. stdin and stdout stand in for files; the
+// stream format is binary (see utils/stream.go). the error is also reported in
+// the result, it is returned for the exit status
+func handleStream(ctx context.Context, path string, mode string, key []byte, wp *utils.WorkerProgress) (opErr error) {
+	start := time.Now()
+	defer wp.Done()
+	name := streamName(path)
+	ctx, span := trace.Start(ctx, "stream "+mode, trace.String("file", name), trace.String("scheme", scheme))
+
+	var counted int64
+	res := opResult{Op: mode, Input: name, Scheme: scheme}
+	defer func() {
+		auditRun(name, counted, opErr)
+		res.Bytes = counted
+		res.took(time.Since(start))
+		res.finish(opErr)
+		emit(res)
+		span.SetAttributes(trace.Int64("bytes", counted))
+		span.FinishErr(opErr)
+	}()
+
+	plugin, _ := utils.GetPlugin(scheme)
+	sp := plugin.(utils.StreamPlugin)
+	pk, err := utils.KeyForPlugin(plugin, key, keyContext)
+	if err != nil {
+		opErr = withCode(codeKey, err)
+		textln("Subkey derivation failed:", err)
+		return
+	}
+	defer pk.Destroy()
+
+	in := io.Reader(os.Stdin)
+	if path != stdioPath {
+		f, err := os.Open(path)
+		if err != nil {
+			opErr = err
+			textf("Failed to read %s: %v\n", path, err)
+			return
+		}
+		defer f.Close()
+		in = f
+		if info, err := f.Stat(); err == nil {
+			wp.Start(path, info.Size())
+		}
+	} else {
+		wp.Start(name, 0)
+	}
+	in = &countingReader{r: wp.Reader(in), n: &counted}
+
+	outPath := streamOutput(path, mode)
+	var out io.Writer
+	var file *utils.AtomicFile
+	switch outPath {
+	case "":
+		out = io.Discard
+	case stdioPath:
+		out = os.Stdout
+	default:
+		opts, err := outputOptions(outPath, mode == "decrypt")
+		if err != nil {
+			opErr = err
+			textln(err)
+			return
+		}
+		if mode == "decrypt" && path != stdioPath {
+			restoreFileInfo(&opts, strings.TrimSuffix(path, ".enc"))
+		}
+		file, err = utils.CreateAtomic(outPath, opts)
+		if err != nil {
+			opErr = err
+			textf("Failed to write %s: %v\n", outPath, err)
+			return
+		}
+		// a failed stream leaves no output behind, not even a truncated one
+		defer file.Abort()
+		out = file
+	}
+
+	if mode == "encrypt" {
+		err = sp.EncryptStream(ctx, in, out, pk.Bytes())
+	} else {
+		err = sp.DecryptStream(ctx, in, out, pk.Bytes())
+	}
+	if err != nil {
+		opErr = withCode(codeCrypto, err)
+		switch mode {
+		case "encrypt":
+			textln("Error encrypting:", err)
+		case "decrypt":
+			textln("Error decrypting:", err)
+		default:
+			textf("FAIL  %s  %v\n", name, err)
+		}
+		return
+	}
+	if mode == "verify" {
+		textf("PASS  %s\n", name)
+		return
+	}
+	if file != nil {
+		if err := file.Commit(); err != nil {
+			opErr = err
+			textf("Failed to write %s: %v\n", outPath, err)
+			return
+		}
+	}
+	res.Output = outPath
+	if outPath == stdioPath {
+		res.Output = "<stdout>"
+	}
+	textf("%s: %s -> %s\n", mode, name, res.Output)
+	return nil
+}
+
+// where a streamed input goes: stdout for stdin, <path>.enc / .dec for a
+// file, nowhere for verify
+func streamOutput(path, mode string) string {
+	switch {
+	case mode == "verify":
+		return ""
+	case outputPath != "":
+		return outputPath
+	case path == stdioPath:
+		return stdioPath
+	case mode == "decrypt":
+		return path + ".dec"
+	}
+	return path + ".enc"
+}
+
+func streamName(path string) string {
+	if path == stdioPath {
+		return "<stdin>"
+	}
+	return path
+}
+
+// creating func to decrypt a whole file in either format: the stream format
+// (written with --out -) is recognised by its header, anything else is the
+// plugin's base64 format
+func decryptData(ctx context.Context, plugin utils.Plugin, data []byte, key []byte) ([]byte, error) {
+	sp, ok := plugin.(utils.StreamPlugin)
+	if !ok || !utils.IsStream(data) {
+		return plugin.Decrypt(string(data), key)
+	}
+	var plain bytes.Buffer
+	if err := sp.DecryptStream(ctx, bytes.NewReader(data), &plain, key); err != nil {
+		utils.Wipe(plain.Bytes())
+		return nil, err
+	}
+	return plain.Bytes(), nil
+}
+
+// counts the bytes read through it, for the result and the audit entry
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/crypto-cli/utils"
+)
+
+// outcome of verifying one encrypted file
+type verifyResult struct {
+	Path   string
+	OK     bool
+	Checks []string
+	Reason string
+	Err    error // the cause when the file couldn't be read or decrypted
+	Took   time.Duration
+}
+
+// creating func for run --mode=verify on files
+// every file is decrypted without writing anything (a stream-format file chunk by
+// chunk, without holding it or its plaintext in memory), checked and
+// reported as PASS or FAIL in input order; the first failure is returned for the exit status
+func verifyFiles(paths []string, key []byte, prog *utils.Progress) error {
+	results := make([]verifyResult, len(paths))
+	workers := 1
+	if concurrent {
+		workers = runWorkers
+	}
+	parallelWorkers("run", len(paths), workers, func(worker, i int) {
+		start := time.Now()
+		results[i] = verifyEncryptedFile(paths[i], key, prog.Worker(worker))
+		results[i].Took = time.Since(start)
+		auditRun(paths[i], 0, results[i].err())
+		utils.Log().Debug("verified", utils.FieldFile, paths[i], utils.FieldScheme, scheme,
+			utils.FieldWorker, worker, "ok", results[i].OK, utils.FieldDuration, time.Since(start))
+	})
+
+	failed := 0
+	var firstErr error
+	for _, r := range results {
+		res := opResult{Op: "verify", Input: r.Path, Scheme: scheme}
+		res.took(r.Took)
+		if len(r.Checks) > 0 {
+			res.detail("checks", r.Checks)
+		}
+		if r.OK {
+			res.finish(nil)
+			emit(res)
+			textf("PASS  %s  (%s)\n", r.Path, strings.Join(r.Checks, ", "))
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = r.err()
+		}
+		res.finish(r.err())
+		emit(res)
+		textf("FAIL  %s  %s\n", r.Path, r.Reason)
+	}
+	textf("%d passed, %d failed\n", len(results)-failed, failed)
+	return reported(firstErr)
+}
+
+// the error of a failed check: its cause, or a mismatch
+func (r verifyResult) err() error {
+	switch {
+	case r.OK:
+		return nil
+	case r.Err != nil:
+		return r.Err
+	}
+	return withCode(codeMismatch, errors.New(r.Reason))
+}
+
+// creating func to check one .enc file against its key, sidecar and metadata
+func verifyEncryptedFile(path string, key []byte, wp *utils.WorkerProgress) verifyResult {
+	defer wp.Done()
+	res := verifyResult{Path: path}
+	fail := func(format string, args ...any) verifyResult {
+		res.Reason = fmt.Sprintf(format, args...)
+		return res
+	}
+	failErr := func(err error) verifyResult {
+		res.Err = err
+		res.Reason = err.Error()
+		return res
+	}
+
+	plugin, ok := utils.GetPlugin(scheme)
+	if !ok {
+		return failErr(utils.UnsupportedSchemeError(scheme))
+	}
+
+	// the sidecars sit next to the original file, not the .enc one
+	orig := strings.TrimSuffix(path, ".enc")
+	// with --encrypt-names the metadata is sealed, it only counts once it is unsealed
+	meta, metaErr := loadMetadata(orig)
+	switch {
+	case metaErr != nil && !errors.Is(metaErr, fs.ErrNotExist):
+		return fail("metadata can't be used: %v", metaErr)
+	case metaErr == nil && meta.Sealed != "":
+		return fail("metadata is sealed, verify with --encrypt-names to open it")
+	}
+	if metaErr == nil && meta.Scheme != "" && meta.Scheme != plugin.Name() {
+		return fail("metadata says the file was encrypted with %s, not %s", meta.Scheme, plugin.Name())
+	}
+
+	pk, err := utils.KeyForPlugin(plugin, key, keyContext)
+	if err != nil {
+		return failErr(withCode(codeKey, fmt.Errorf("subkey derivation failed: %w", err)))
+	}
+	defer pk.Destroy()
+
+	// the plaintext goes through the checks as it is decrypted: a sha256 hasher
+	// and, with a merkle root in the metadata, the chunk verifier
+	hasher := sha256.New()
+	var mv *utils.MerkleVerifier
+	if metaErr == nil && meta.MerkleRoot != "" {
+		tree, err := utils.LoadMerkleFile(orig + ".merkle.yaml")
+		if err != nil {
+			return fail("metadata has a merkle root but the manifest can't be read: %v", err)
+		}
+		if err := tree.CheckRoot(meta.MerkleRoot); err != nil {
+			return fail("%v", err)
+		}
+		mk, err := merkleKey(key)
+		if err != nil {
+			return fail("%v", err)
+		}
+		defer utils.Wipe(mk)
+		tree.SetKey(mk)
+		mv = tree.NewVerifier()
+	}
+	sink := io.Writer(hasher)
+	if mv != nil {
+		sink = io.MultiWriter(hasher, mv)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return failErr(fmt.Errorf("cannot read: %w", err))
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		wp.Start(path, info.Size())
+	}
+	in := bufio.NewReader(wp.Reader(f))
+	head, _ := in.Peek(len(utils.StreamMagic))
+	if sp, ok := plugin.(utils.StreamPlugin); ok && utils.IsStream(head) {
+		// a stream is decrypted chunk by chunk, neither it nor its plaintext is held in memory
+		err = sp.DecryptStream(context.Background(), in, sink, pk.Bytes())
+	} else {
+		// the base64 format has to be decoded whole
+		var data []byte
+		if data, err = io.ReadAll(in); err != nil {
+			return failErr(fmt.Errorf("cannot read: %w", err))
+		}
+		var plain []byte
+		if plain, err = decryptData(context.Background(), plugin, data, pk.Bytes()); err == nil {
+			sink.Write(plain)
+			utils.Wipe(plain)
+		}
+	}
+	if err != nil {
+		return failErr(withCode(codeCrypto, fmt.Errorf("decryption failed: %w", err)))
+	}
+
+	authenticated := false
+	if ap, ok := plugin.(utils.AEADPlugin); ok && ap.Authenticated() {
+		authenticated = true
+		res.Checks = append(res.Checks, "aead tag")
+	} else {
+		res.Checks = append(res.Checks, "decrypts")
+	}
+
+	sidecar, err := utils.ReadChecksumFile(orig)
+	switch {
+	case err == nil:
+		if !strings.EqualFold(strings.TrimSpace(sidecar), hex.EncodeToString(hasher.Sum(nil))) {
+			return fail("sha256 of the decrypted data does not match %s.sha256", orig)
+		}
+		res.Checks = append(res.Checks, "sha256")
+	case !os.IsNotExist(err):
+		return fail("%v", err)
+	case !authenticated:
+		// nothing proves a cbc file is intact without its checksum
+		utils.Warn("%s: %s is unauthenticated and no .sha256 sidecar was found", path, plugin.Name())
+		res.Checks = append(res.Checks, "unauthenticated, no checksum")
+	}
+
+	if metaErr == nil {
+		res.Checks = append(res.Checks, "metadata")
+		if mv != nil {
+			bad, err := mv.Finish()
+			if err != nil {
+				return fail("%v", err)
+			}
+			if len(bad) > 0 {
+				ranges := make([]string, len(bad))
+				for i, r := range bad {
+					ranges[i] = r.String()
+				}
+				return fail("merkle mismatch in %s", strings.Join(ranges, ", "))
+			}
+			res.Checks = append(res.Checks, "merkle")
+		}
+	}
+	res.OK = true
+	return res
+}
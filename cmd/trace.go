@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"example.com/crypto-cli/internal/trace"
+	"example.com/crypto-cli/utils"
+)
+
+// creating variables
+var traceFile string
+
+// creating func to install the OTLP/JSON file exporter when --trace-file is set,
+// tracing stays a no-op otherwise
+func startTracing() error {
+	if traceFile == "" {
+		return nil
+	}
+	exp, err := trace.NewFileExporter(traceFile, "crypto-cli")
+	if err != nil {
+		return err
+	}
+	trace.SetExporter(exp)
+	return nil
+}
+
+// flushing the spans still buffered when the command ends
+func stopTracing() {
+	if err := trace.Shutdown(); err != nil {
+		utils.Warn("failed to write traces to %s: %v", traceFile, err)
+	}
+}
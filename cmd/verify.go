@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/crypto-cli/utils"
+	"github.com/spf13/cobra"
+)
+
+// creating variables
+var verifyMerkle bool
+var verifyManifest string
+var verifyRange string
+
+// creating cobra logic
+var verifyCmd = &cobra.Command{
+	Use:   "verify [files...]",
+	Short: "Verify files against their integrity manifests",
+	Long: "With --merkle, check each file against its chunked Merkle manifest (<file>.merkle.yaml,\n" +
+		"written by run --merkle) and print the byte ranges of every corrupted chunk.\n" +
+		"The manifest's root is first checked against the root stored in <file>.meta.yaml.\n" +
+		"--range START-END checks only the chunks overlapping those bytes, without reading the rest.\n" +
+		"Manifests written by run --merkle are keyed: pass the key options used with run\n" +
+		"(the salt and scheme are taken from the metadata when not given).",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !verifyMerkle {
+			return withCode(codeUsage, errors.New("nothing to verify, use --merkle (encrypted files are checked with run --mode=verify)"))
+		}
+		if len(args) == 0 {
+			return withCode(codeUsage, errors.New("no files given"))
+		}
+		if verifyManifest != "" && len(args) > 1 {
+			return withCode(codeUsage, errors.New("--manifest can only be used with a single file"))
+		}
+		defer merkleKeys.destroy()
+		// every file is reported on its own, the first failure sets the exit status
+		var firstErr error
+		for _, path := range args {
+			if err := verifyMerkleFile(cmd, path); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return reported(firstErr)
+	},
+}
+
+// the leaf key of keyed manifests, resolved from the key options on the first
+// keyed manifest and used for the rest
+var merkleKeys verifyKey
+
+type verifyKey struct {
+	key []byte
+	err error
+	set bool
+}
+
+// creating func to give the leaf key for the manifest of a file with metadata meta
+func (v *verifyKey) get(cmd *cobra.Command, meta utils.Metadata) ([]byte, error) {
+	if v.set {
+		return v.key, v.err
+	}
+	v.set = true
+	given := false
+	for _, name := range []string{"key", "keyfile", "key-id", "password"} {
+		given = given || cmd.Flags().Changed(name)
+	}
+	if !given {
+		v.err = withCode(codeKey, fmt.Errorf("%w (pass --key, --keyfile, --key-id or --password)", utils.ErrMerkleKeyRequired))
+		return nil, v.err
+	}
+	// the salt and scheme of the run that wrote the manifest
+	if salt == "" {
+		salt = meta.Salt
+	}
+	if !cmd.Flags().Changed("scheme") && meta.Scheme != "" {
+		scheme = meta.Scheme
+	}
+	if password != "" && salt == "" {
+		v.err = withCode(codeUsage, errors.New("--password needs --salt, the metadata has none"))
+		return nil, v.err
+	}
+	master, err := loadKey(cmd.Context(), false)
+	if err != nil {
+		v.err = err
+		return nil, err
+	}
+	defer master.Destroy()
+	v.key, v.err = merkleKey(master.Bytes())
+	return v.key, v.err
+}
+
+func (v *verifyKey) destroy() {
+	utils.Wipe(v.key)
+}
+
+// checking one file, returns an error when it is corrupted or can't be checked
+func verifyMerkleFile(cmd *cobra.Command, path string) error {
+	manifestPath := verifyManifest
+	if manifestPath == "" {
+		manifestPath = path + ".merkle.yaml"
+	}
+	res := opResult{Op: "verify", Input: path}
+	res.detail("manifest", manifestPath)
+	failed := func(err error) error {
+		res.finish(err)
+		emit(res)
+		textf("%s: FAILED (%v)\n", path, err)
+		return err
+	}
+	tree, err := utils.LoadMerkleFile(manifestPath)
+	if err != nil {
+		return failed(err)
+	}
+	res.Algorithm = tree.Algo
+	res.Checksum = tree.Root
+	// the metadata sits next to the manifest, both are named after the original file
+	meta, err := utils.LoadMetadataFile(strings.TrimSuffix(manifestPath, ".merkle.yaml"))
+	if err != nil {
+		utils.Warn("no metadata found for %s, the manifest root can't be cross-checked", path)
+	}
+	if err := tree.CheckRoot(meta.MerkleRoot); err != nil {
+		return failed(withCode(codeMismatch, err))
+	}
+	if tree.Keyed {
+		mk, err := merkleKeys.get(cmd, meta)
+		if err != nil {
+			return failed(err)
+		}
+		tree.SetKey(mk)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return failed(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return failed(err)
+	}
+	res.Bytes = info.Size()
+
+	var bad []utils.ByteRange
+	if verifyRange != "" {
+		start, end, perr := parseByteRange(verifyRange, info.Size())
+		if perr != nil {
+			return failed(withCode(codeUsage, perr))
+		}
+		bad, err = tree.VerifyRange(f, info.Size(), start, end)
+	} else {
+		bad, err = tree.Verify(f, info.Size())
+	}
+	if err != nil {
+		return failed(err)
+	}
+	if len(bad) == 0 {
+		res.finish(nil)
+		emit(res)
+		textf("%s: OK\n", path)
+		return nil
+	}
+	textf("%s: FAILED\n", path)
+	corrupted := make([]string, len(bad))
+	for i, r := range bad {
+		first := r.Start / tree.ChunkSize
+		last := (r.End - 1) / tree.ChunkSize
+		corrupted[i] = fmt.Sprintf("%s (chunks %d-%d)", r, first, last)
+		textf("  corrupted: %s\n", corrupted[i])
+	}
+	res.detail("corrupted", corrupted)
+	err = withCode(codeMismatch, fmt.Errorf("%d corrupted range(s)", len(bad)))
+	res.finish(err)
+	emit(res)
+	return err
+}
+
+// parsing "START-END" (inclusive, END may be left out for end of file)
+// into a half-open [start, end) range
+func parseByteRange(s string, size int64) (int64, int64, error) {
+	startStr, endStr, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid range %q, expected START-END", s)
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid range start %q", startStr)
+	}
+	end := size
+	if endStr != "" {
+		last, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || last < start {
+			return 0, 0, fmt.Errorf("invalid range end %q", endStr)
+		}
+		end = last + 1
+	}
+	return start, end, nil
+}
+
+func init() {
+	verifyCmd.Flags().BoolVar(&verifyMerkle, "merkle", false, "Verify against the chunked Merkle manifest")
+	verifyCmd.Flags().StringVar(&verifyManifest, "manifest", "", "Merkle manifest to use (default: <file>.merkle.yaml), e.g. to check a decrypted copy")
+	verifyCmd.Flags().StringVar(&verifyRange, "range", "", "Only verify bytes START-END (inclusive)")
+	// the key options of run, for keyed manifests. run's init has defined them
+	// already (run.go sorts before verify.go)
+	for _, name := range []string{"key", "keyfile", "key-id", "password", "salt", "scheme", "context"} {
+		verifyCmd.Flags().AddFlag(runCmd.Flags().Lookup(name))
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/crypto-cli/utils"
+)
+
+// creating variables
+var overwritePolicy string
+var outputPerm string
+
+// the parsed --perm, only used when permSet
+var permOverride os.FileMode
+var permSet bool
+
+// creating func to check --overwrite and --perm before the command runs
+func validWriteFlags() error {
+	switch overwritePolicy {
+	case utils.OverwriteNever, utils.OverwriteAlways, utils.OverwritePrompt:
+	default:
+		return withCode(codeUsage, fmt.Errorf("unknown overwrite policy: %s (choose %s)", overwritePolicy, strings.Join(utils.OverwritePolicies, ", ")))
+	}
+	if outputPerm == "" {
+		return nil
+	}
+	perm, err := strconv.ParseUint(outputPerm, 8, 32)
+	if err != nil || perm > 0777 {
+		return withCode(codeUsage, fmt.Errorf("invalid --perm %q: want an octal mode such as 0600", outputPerm))
+	}
+	permOverride, permSet = os.FileMode(perm), true
+	return nil
+}
+
+// creating func to get the write options of an output: the overwrite policy is
+// applied here, before any work, and the mode is --perm or the default for
+// plaintext (0600) or ciphertext (0644)
+func outputOptions(path string, plaintext bool) (utils.WriteOptions, error) {
+	replace, err := utils.CheckOverwrite(path, overwritePolicy)
+	if err != nil {
+		return utils.WriteOptions{}, err
+	}
+	opts := utils.WriteOptions{Perm: utils.CiphertextPerm, Replace: replace}
+	if plaintext {
+		opts.Perm = utils.PlaintextPerm
+	}
+	if permSet {
+		opts.Perm = permOverride
+	}
+	return opts, nil
+}
+
+// creating func to give a decrypted output the mode and mtime of the original
+// file, as recorded in its metadata (--perm still wins for the mode)
+func restoreFileInfo(opts *utils.WriteOptions, origPath string) {
+	meta, err := loadMetadata(origPath)
+	if err != nil {
+		// no metadata is fine, metadata that doesn't open (swapped, tampered) is worth a word
+		if !errors.Is(err, fs.ErrNotExist) {
+			utils.Warn("%s: metadata not used: %v", origPath, err)
+		}
+		return
+	}
+	if mode, ok := meta.FileMode(); ok && !permSet {
+		opts.Perm = mode
+	}
+	opts.ModTime = meta.ModTime
+}
@@ -3,7 +3,7 @@ package crypto
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"errors"
+	"fmt"
 	"io"
 
 	"golang.org/x/crypto/chacha20poly1305"
@@ -32,7 +32,7 @@ func DecryptChaCha20(enc string, key []byte) ([]byte, error) {
 	// decoding the ciphertext
 	data, err := base64.StdEncoding.DecodeString(enc)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrTruncated, err)
 	}
 
 	// creating a new chacha20poly1305 key
@@ -42,13 +42,17 @@ func DecryptChaCha20(enc string, key []byte) ([]byte, error) {
 	}
 
 	// removing nonce size
-	if len(data) < chacha20poly1305.NonceSize {
-		return nil, errors.New("invalid data size")
+	if len(data) < chacha20poly1305.NonceSize+chacha20poly1305.Overhead {
+		return nil, ErrTruncated
 	}
 
 	nonce := data[:chacha20poly1305.NonceSize]
 	plaintext := data[chacha20poly1305.NonceSize:]
 
 	// return the decrypted file/string
-	return aead.Open(nil, nonce, plaintext, nil)
+	plain, err := aead.Open(nil, nonce, plaintext, nil)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plain, nil
 }
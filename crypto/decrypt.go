@@ -4,24 +4,41 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
+	"fmt"
 )
 
 // func to unpad padded algorithm
-func unpad(src []byte) []byte {
+// a wrong key decrypts to random bytes, so the padding is checked instead of trusted
+func unpad(src []byte) ([]byte, error) {
 	length := len(src)
 	unpad1 := int(src[length-1])
-	return src[:(length - unpad1)]
+	if unpad1 == 0 || unpad1 > aes.BlockSize {
+		return nil, ErrBadPadding
+	}
+	for _, b := range src[length-unpad1:] {
+		if int(b) != unpad1 {
+			return nil, ErrBadPadding
+		}
+	}
+	return src[:(length - unpad1)], nil
 }
 
 // func for decryption algorithm
-func Decrypt(cryptoText string, key []byte) (string, error) {
+func Decrypt(cryptoText string, key []byte) ([]byte, error) {
 	// Decoding encrypted string
-	ciphertext, _ := base64.StdEncoding.DecodeString(cryptoText)
+	ciphertext, err := base64.StdEncoding.DecodeString(cryptoText)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	// the IV plus at least one whole block
+	if len(ciphertext) < 2*aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrTruncated
+	}
 
 	// creating private cipher key
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("%w: %v", ErrKeyLength, err)
 	}
 
 	// creating initialization vector
@@ -34,6 +51,7 @@ func Decrypt(cryptoText string, key []byte) (string, error) {
 	mode.CryptBlocks(ciphertext, ciphertext)
 
 	// return unpadded plaintext
-	return string(unpad(ciphertext)), nil
+	// kept as bytes so callers can wipe it, a string would stay on the heap
+	return unpad(ciphertext)
 
 }
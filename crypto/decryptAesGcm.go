@@ -4,33 +4,36 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
-	"errors"
-	"log"
+	"fmt"
 
 	"example.com/crypto-cli/utils"
 )
 
-func DecryptAesGcm(cipherHex string, password string) ([]byte, error) {
+func DecryptAesGcm(cipherHex string, password []byte) ([]byte, error) {
 	// decoding the strings
 	data, err := base64.StdEncoding.DecodeString(cipherHex)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	// salt, nonce and at least the 16-byte tag
+	if len(data) < utils.SaltSize+12+16 {
+		return nil, ErrTruncated
 	}
 	// Extract the salt, nonce and get ciphertext
 	// note: salt (first 16 bytes), nonce (next 12 bytes), rest is ciphertext
-	var scheme string
 	salt := data[:utils.SaltSize]
 	nonce := data[utils.SaltSize:utils.SaltSize+12]
 	ciphertext := data[utils.SaltSize+12:]
 
 	// getting your derived key
-	derivedKey, err := utils.DeriveKeyWithScheme(password, salt, scheme)
-	if err != nil{
-		log.Fatalf("Key derivation failed: %v", err)
+	derivedKey, err := utils.DeriveKeyWithScheme(password, salt, "gcm")
+	if err != nil {
+		return nil, err
 	}
+	defer derivedKey.Destroy()
 
 	// initiating cipher key
-	block, err := aes.NewCipher(derivedKey)
+	block, err := aes.NewCipher(derivedKey.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -39,16 +42,10 @@ func DecryptAesGcm(cipherHex string, password string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	// creating nonce size and calculating its length from the original nonce size
-	nonceSize := aesgcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, errors.New("ciphertext is too short")
-	}
-
 	// decrypting the ciphertest to its original file
 	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return nil, err
+		return nil, ErrAuthFailed
 	}
 	return plaintext, nil
 }
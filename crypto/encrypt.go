@@ -23,7 +23,10 @@ func pad(src []byte) []byte {
 	// this is PKCS#7 padding scheme
 	padding := aes.BlockSize - len(src)%aes.BlockSize
 	padText := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(src, padText...)
+	// copying first: appending to src could overwrite the caller's data past len(src)
+	padded := make([]byte, 0, len(src)+padding)
+	padded = append(padded, src...)
+	return append(padded, padText...)
 }
 
 // function for encryption algorithm
@@ -6,26 +6,25 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"io"
-	"log"
 
 	"example.com/crypto-cli/utils"
 )
 
-func EncryptAesGcm(plaintext []byte, password string) (string, error) {
+func EncryptAesGcm(plaintext []byte, password []byte) (string, error) {
 	// creating salt for hashing
 	salt, err := utils.GenerateSalt()
 	if err != nil {
 		return "", err
 	}
-	var scheme string
 	// implementing salt for key generation
-	derivedKey, err := utils.DeriveKeyWithScheme(password, salt, scheme)
-	if err != nil{
-		log.Fatalf("Key derivation failed: %v", err)
+	derivedKey, err := utils.DeriveKeyWithScheme(password, salt, "gcm")
+	if err != nil {
+		return "", err
 	}
+	defer derivedKey.Destroy()
 
 	// initiating cipher key
-	block, err := aes.NewCipher(derivedKey)
+	block, err := aes.NewCipher(derivedKey.Bytes())
 	if err != nil {
 		return "", err
 	}
@@ -40,7 +39,7 @@ func EncryptAesGcm(plaintext []byte, password string) (string, error) {
 		return "", err
 	}
 	// Implementing the AES Encryption Algorithm to create the ciphertext
-	ciphertext := aesgcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
 
 	// prepared nonce 2 ciphertext
 	// combining salt + nonce + ciphertext and return base64
@@ -0,0 +1,14 @@
+package crypto
+
+import "example.com/crypto-cli/utils"
+
+// the sentinel errors live in utils so plugins and commands share them,
+// they are re-exported here for callers that only use this package
+var (
+	ErrAuthFailed        = utils.ErrAuthFailed
+	ErrBadPadding        = utils.ErrBadPadding
+	ErrUnsupportedScheme = utils.ErrUnsupportedScheme
+	ErrKeyLength         = utils.ErrKeyLength
+	ErrTruncated         = utils.ErrTruncated
+	ErrExists            = utils.ErrExists
+)
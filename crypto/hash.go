@@ -1,61 +1,75 @@
 package crypto
 
 import (
-	"crypto/md5"
-	"crypto/sha256"
-	"crypto/sha512"
 	"encoding/hex"
-	"errors"
-	"hash"
 	"io"
 	"os"
+	"strings"
+
+	"example.com/crypto-cli/utils"
 )
 
 // Creating a func to hash strings hash logic
+// algorithms come from the registry in utils/hashes.go
 func HashString(input string, algo string) (string, error) {
-	// creating variable hash with a type []byte
-	var hash []byte
-
-	// implementing switch to select between hashing algorithms
-	switch algo {
-	case "sha256":
-		sum := sha256.Sum256([]byte(input))
-		hash = sum[:]
-	case "sha512":
-		sum := sha512.Sum512([]byte(input))
-		hash = sum[:]
-	case "md5":
-		sum := md5.Sum([]byte(input))
-		hash = sum[:]
-	default:
-		return "", errors.New("unsupported algorithm: choose sha256, sha512, or md5")
+	sum, err := utils.HashBytes([]byte(input), algo)
+	if err != nil {
+		return "", err
 	}
-	return hex.EncodeToString(hash), nil
+	return hex.EncodeToString(sum), nil
 }
 
+// hashing a file, "-" reads from stdin
 func HashFile(filepath string, algo string) (string, error) {
-	// creating variable hash with a type hash.hash
-	var h hash.Hash
-
-	// implementing switch to select between hashing algorithms
-	switch algo {
-	case "sha256":
-		h = sha256.New()
-	case "sha512":
-		h = sha512.New()
-	case "md5":
-		h = md5.New()
-	default:
-		return "", errors.New("unsupported algorithm: choose sha256, sha512, or md5")
+	digest, _, err := HashFileSize(filepath, algo)
+	return digest, err
+}
+
+// same as HashFile, also returning the number of bytes hashed
+func HashFileSize(filepath string, algo string) (string, int64, error) {
+	file, err := openHashInput(filepath)
+	if err != nil {
+		return "", 0, err
 	}
-	file, err := os.Open(filepath)
+	defer file.Close()
+
+	sum, n, err := utils.HashReaderN(file, algo)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(sum), n, nil
+}
+
+// creating func to compute a MAC of a string
+// native uses the keyed mode of BLAKE2/BLAKE3 instead of HMAC
+func MACString(input string, algo string, key []byte, native bool) (string, error) {
+	return macReader(strings.NewReader(input), algo, key, native)
+}
+
+// creating func to compute a MAC of a file, "-" reads from stdin
+func MACFile(filepath string, algo string, key []byte, native bool) (string, error) {
+	file, err := openHashInput(filepath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
+	return macReader(file, algo, key, native)
+}
 
-	if _, err := io.Copy(h, file); err != nil {
+func macReader(r io.Reader, algo string, key []byte, native bool) (string, error) {
+	mac, err := utils.NewMAC(algo, key, native)
+	if err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(h.Sum(nil)), nil
+	if _, err := io.Copy(mac, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func openHashInput(filepath string) (io.ReadCloser, error) {
+	if filepath == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(filepath)
 }
@@ -0,0 +1,83 @@
+package crypto
+
+// encrypted filenames: every path component is padded to a multiple of 16
+// bytes (so only a rough length shows), sealed with AES-SIV and written as
+// unpadded base64url, which is safe in file names. The plaintext parent
+// directory is associated data, so the same name in two directories encrypts
+// differently and a name moved to another directory no longer opens
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// longest name that still fits the 255 byte limit of most file systems once
+// encrypted and given the longest sidecar suffix (.merkle.yaml)
+const MaxNameLen = 159
+
+var nameEncoding = base64.RawURLEncoding
+
+// associated data that keeps name ciphertexts apart from anything else sealed with the key
+var nameAD = []byte("crypto-cli name v1")
+
+// creating func to encrypt one path component, parent is its plaintext
+// directory ("" for none) with / separators
+func EncryptName(s *SIV, name, parent string) (string, error) {
+	if len(name) > MaxNameLen {
+		return "", fmt.Errorf("name %q is too long to encrypt (%d bytes, at most %d)", name, len(name), MaxNameLen)
+	}
+	return nameEncoding.EncodeToString(s.Seal(pad([]byte(name)), nameAD, []byte(parent))), nil
+}
+
+// creating func to decrypt one path component sealed by EncryptName under the same parent
+func DecryptName(s *SIV, enc, parent string) (string, error) {
+	sealed, err := nameEncoding.DecodeString(enc)
+	if err != nil || len(sealed) < SIVSize+16 || (len(sealed)-SIVSize)%16 != 0 {
+		return "", fmt.Errorf("%w: %q is not an encrypted name", ErrTruncated, enc)
+	}
+	padded, err := s.Open(sealed, nameAD, []byte(parent))
+	if err != nil {
+		return "", err
+	}
+	name, err := unpad(padded)
+	if err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
+
+// creating func to encrypt a relative path (/ separated) component by component
+func EncryptPath(s *SIV, rel string) (string, error) {
+	parts := strings.Split(rel, "/")
+	parent := ""
+	for i, name := range parts {
+		enc, err := EncryptName(s, name, parent)
+		if err != nil {
+			return "", err
+		}
+		parent = path.Join(parent, name)
+		parts[i] = enc
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// creating func to decrypt a relative path written by EncryptPath
+func DecryptPath(s *SIV, rel string) (string, error) {
+	parts := strings.Split(rel, "/")
+	parent := ""
+	for i, enc := range parts {
+		name, err := DecryptName(s, enc, parent)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", rel, err)
+		}
+		// a decrypted name must stay one component, whatever the ciphertext said
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+			return "", fmt.Errorf("%s: refusing to restore unsafe name %q", rel, name)
+		}
+		parent = path.Join(parent, name)
+		parts[i] = name
+	}
+	return strings.Join(parts, "/"), nil
+}
@@ -0,0 +1,158 @@
+package crypto
+
+// AES-SIV (RFC 5297): deterministic authenticated encryption. The same key,
+// plaintext and associated data always give the same ciphertext, which is what
+// encrypted filenames need (a name must encrypt to the same string every time
+// so it can be found again), while any change to the ciphertext still fails
+// to open. The synthetic IV is an AES-CMAC over the associated data and the
+// plaintext (S2V), and doubles as the CTR counter and the tag
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+)
+
+// size of the synthetic IV that prefixes every ciphertext
+const SIVSize = aes.BlockSize
+
+type SIV struct {
+	mac cipher.Block // K1, for S2V
+	ctr cipher.Block // K2, for the CTR encryption
+}
+
+// creating func to set up AES-SIV with a 32, 48 or 64 byte key
+// (AES-128, -192 or -256; the first half keys the CMAC, the second CTR)
+func NewSIV(key []byte) (*SIV, error) {
+	switch len(key) {
+	case 32, 48, 64:
+	default:
+		return nil, fmt.Errorf("%w: AES-SIV needs 32, 48 or 64 bytes, got %d", ErrKeyLength, len(key))
+	}
+	half := len(key) / 2
+	mac, err := aes.NewCipher(key[:half])
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(key[half:])
+	if err != nil {
+		return nil, err
+	}
+	return &SIV{mac: mac, ctr: ctr}, nil
+}
+
+// creating func to encrypt plaintext, returning the synthetic IV followed by the ciphertext
+// every ad element is authenticated separately, so ("a", "bc") and ("ab", "c") differ
+func (s *SIV) Seal(plaintext []byte, ad ...[]byte) []byte {
+	v := s.s2v(plaintext, ad)
+	out := make([]byte, SIVSize+len(plaintext))
+	copy(out, v[:])
+	s.xorCTR(out[SIVSize:], plaintext, v)
+	return out
+}
+
+// creating func to decrypt and authenticate a Seal output with the same ad
+func (s *SIV) Open(ciphertext []byte, ad ...[]byte) ([]byte, error) {
+	if len(ciphertext) < SIVSize {
+		return nil, ErrTruncated
+	}
+	var v [aes.BlockSize]byte
+	copy(v[:], ciphertext[:SIVSize])
+	plain := make([]byte, len(ciphertext)-SIVSize)
+	s.xorCTR(plain, ciphertext[SIVSize:], v)
+	want := s.s2v(plain, ad)
+	if subtle.ConstantTimeCompare(want[:], v[:]) != 1 {
+		for i := range plain {
+			plain[i] = 0
+		}
+		return nil, ErrAuthFailed
+	}
+	return plain, nil
+}
+
+// CTR with the IV's bits 31 and 63 cleared, as the RFC asks (section 2.5)
+func (s *SIV) xorCTR(dst, src []byte, v [aes.BlockSize]byte) {
+	q := v
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	cipher.NewCTR(s.ctr, q[:]).XORKeyStream(dst, src)
+}
+
+// S2V (RFC 5297 section 2.4), with the plaintext as the last string
+func (s *SIV) s2v(plaintext []byte, ad [][]byte) [aes.BlockSize]byte {
+	var zero [aes.BlockSize]byte
+	d := cmac(s.mac, zero[:])
+	for _, a := range ad {
+		d = dbl(d)
+		m := cmac(s.mac, a)
+		xorBlock(&d, m[:])
+	}
+	var t []byte
+	if len(plaintext) >= aes.BlockSize {
+		// xorend: D goes over the last 16 bytes
+		t = append([]byte(nil), plaintext...)
+		tail := t[len(t)-aes.BlockSize:]
+		for i := range tail {
+			tail[i] ^= d[i]
+		}
+	} else {
+		d = dbl(d)
+		var padded [aes.BlockSize]byte
+		copy(padded[:], plaintext)
+		padded[len(plaintext)] = 0x80
+		xorBlock(&d, padded[:])
+		t = d[:]
+	}
+	return cmac(s.mac, t)
+}
+
+// AES-CMAC (RFC 4493)
+func cmac(block cipher.Block, msg []byte) [aes.BlockSize]byte {
+	var l [aes.BlockSize]byte
+	block.Encrypt(l[:], l[:])
+	k1 := dbl(l)
+	k2 := dbl(k1)
+
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(msg)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+	var last [aes.BlockSize]byte
+	rest := msg[(n-1)*aes.BlockSize:]
+	copy(last[:], rest)
+	if complete {
+		xorBlock(&last, k1[:])
+	} else {
+		last[len(rest)] = 0x80
+		xorBlock(&last, k2[:])
+	}
+
+	var x [aes.BlockSize]byte
+	for i := 0; i < n-1; i++ {
+		xorBlock(&x, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x[:], x[:])
+	}
+	xorBlock(&x, last[:])
+	block.Encrypt(x[:], x[:])
+	return x
+}
+
+// doubling in GF(2^128), the shift-and-reduce of CMAC and S2V
+func dbl(b [aes.BlockSize]byte) [aes.BlockSize]byte {
+	var out [aes.BlockSize]byte
+	carry := b[0] >> 7
+	for i := 0; i < aes.BlockSize-1; i++ {
+		out[i] = b[i]<<1 | b[i+1]>>7
+	}
+	out[aes.BlockSize-1] = b[aes.BlockSize-1] << 1
+	out[aes.BlockSize-1] ^= 0x87 * carry
+	return out
+}
+
+func xorBlock(dst *[aes.BlockSize]byte, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// the two examples of RFC 5297 appendix A
+func TestSIVVectors(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		ad    []string
+		plain string
+		want  string
+	}{
+		{
+			name: "A.1 deterministic",
+			key: "fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0" +
+				"f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff",
+			ad:    []string{"10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627"},
+			plain: "11223344 55667788 99aabbcc ddee",
+			want: "85632d07 c6e8f37f 950acd32 0a2ecc93" +
+				"40c02b96 90c4dc04 daef7f6a fe5c",
+		},
+		{
+			name: "A.2 nonce-based",
+			key: "7f7e7d7c 7b7a7978 77767574 73727170" +
+				"40414243 44454647 48494a4b 4c4d4e4f",
+			ad: []string{
+				"00112233 44556677 8899aabb ccddeeff deaddada deaddada ffeeddcc bbaa9988 77665544 33221100",
+				"10203040 50607080 90a0",
+				// the nonce is the last associated data component
+				"09f91102 9d74e35b d84156c5 635688c0",
+			},
+			plain: "74686973 20697320 736f6d65 20706c61 696e7465 78742074 6f20656e 63727970" +
+				"74207573 696e6720 5349562d 414553",
+			want: "7bdb6e3b 432667eb 06f4d14b ff2fbd0f cb900f2f ddbe4043 26601965 c889bf17" +
+				"dba77ceb 094fa663 b7a3f748 ba8af829 ea64ad54 4a272e9c 485b62a3 fd5c0d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSIV(unhex(t, tt.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ad [][]byte
+			for _, a := range tt.ad {
+				ad = append(ad, unhex(t, a))
+			}
+			plain := unhex(t, tt.plain)
+			want := unhex(t, tt.want)
+
+			got := s.Seal(plain, ad...)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("Seal = %x, want %x", got, want)
+			}
+			opened, err := s.Open(got, ad...)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if !bytes.Equal(opened, plain) {
+				t.Fatalf("Open = %x, want %x", opened, plain)
+			}
+		})
+	}
+}
+
+func TestSIVRejectsTampering(t *testing.T) {
+	s, err := NewSIV(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := s.Seal([]byte("report.pdf"), []byte("dir"))
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	if _, err := s.Open(flipped, []byte("dir")); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("flipped ciphertext: got %v, want ErrAuthFailed", err)
+	}
+	if _, err := s.Open(sealed, []byte("other")); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("other ad: got %v, want ErrAuthFailed", err)
+	}
+	// the ad elements are bound separately, not concatenated
+	if _, err := s.Open(sealed, []byte("d"), []byte("ir")); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("split ad: got %v, want ErrAuthFailed", err)
+	}
+	if _, err := s.Open(sealed[:SIVSize-1], []byte("dir")); !errors.Is(err, ErrTruncated) {
+		t.Errorf("short input: got %v, want ErrTruncated", err)
+	}
+}
+
+func TestSIVKeyLength(t *testing.T) {
+	for _, n := range []int{0, 16, 31, 65} {
+		if _, err := NewSIV(make([]byte, n)); !errors.Is(err, ErrKeyLength) {
+			t.Errorf("%d byte key: got %v, want ErrKeyLength", n, err)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package audit
+
+// an append-only, tamper-evident record of cryptographic operations.
+//
+// every entry is one JSON line. Its hash is SHA-256 over the entry (without the
+// hash and mac fields) and each entry carries the hash of the one before it,
+// so editing, inserting or removing a line breaks the chain from that point.
+// With a key every hash is also HMAC-signed, so the chain can't simply be
+// recomputed after an edit.
+//
+// truncating the tail leaves a valid chain, so the sequence number and hash of
+// the last entry are also kept in <log>.head; verify compares the two. A head
+// left one entry behind by a crash is caught up on the next append.
+// Secrets are never logged: entries name the key (keystore ID or how it was
+// derived), never its bytes
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/crypto-cli/utils"
+)
+
+// one audited operation
+type Entry struct {
+	Seq       uint64 `json:"seq"`
+	Time      string `json:"time"`
+	User      string `json:"user"`
+	Host      string `json:"host"`
+	PID       int    `json:"pid"`
+	Command   string `json:"command"`
+	Op        string `json:"op"`
+	Target    string `json:"target,omitempty"`
+	Scheme    string `json:"scheme,omitempty"` // encryption scheme, or the hash algorithm
+	KeyID     string `json:"key_id,omitempty"`
+	KeySource string `json:"key_source,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+	Prev      string `json:"prev"`
+	Hash      string `json:"hash"`
+	Mac       string `json:"mac,omitempty"`
+}
+
+// Result values
+const (
+	ResultOK   = "ok"
+	ResultFail = "fail"
+)
+
+// Log appends entries to one audit file, safe for concurrent use
+// (and across processes where file locking is available)
+type Log struct {
+	mu   sync.Mutex
+	path string
+	key  []byte
+	user string
+	host string
+}
+
+// one problem found by Verify
+type Problem struct {
+	Line   int // 0 for problems with the head file
+	Reason string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return p.Reason
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Reason)
+}
+
+// outcome of Verify
+type Report struct {
+	Entries  int
+	Signed   bool // every entry's MAC was checked
+	Problems []Problem
+}
+
+func (r Report) OK() bool { return len(r.Problems) == 0 }
+
+// creating func to derive the HMAC key for the audit log from a master key
+func DeriveKey(master []byte) ([]byte, error) {
+	return utils.DeriveSubkey(master, "audit", "", "hmac-sha256", 32)
+}
+
+// creating func to open (or start) the audit log at path
+// key may be nil for an unsigned, hash-chained only log
+func Open(path string, key []byte) *Log {
+	l := &Log{path: path, key: append([]byte(nil), key...)}
+	if u, err := user.Current(); err == nil {
+		l.user = u.Username
+	} else {
+		l.user = os.Getenv("USER")
+	}
+	l.host, _ = os.Hostname()
+	return l
+}
+
+// wiping the HMAC key
+func (l *Log) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	utils.Wipe(l.key)
+	l.key = nil
+}
+
+// creating func to append one entry
+// Seq, Time, User, Host, PID, Prev, Hash and Mac are filled in here
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	defer unlockFile(f)
+
+	// the head is read under the lock so two processes never fork the chain
+	seq, prev, err := l.readHead(f)
+	if err != nil {
+		return err
+	}
+	e.Seq = seq + 1
+	e.Prev = prev
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	e.User, e.Host, e.PID = l.user, l.host, os.Getpid()
+	e.Hash, e.Mac = "", ""
+	sum, err := entryHash(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = sum
+	if l.key != nil {
+		e.Mac = sign(l.key, e.Hash)
+	}
+
+	line, err := marshalEntry(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return l.writeHead(e)
+}
+
+// the head file is "<seq> <hash> [<mac>]"
+func headPath(path string) string { return path + ".head" }
+
+// the head and the last entry of the log have to agree. A crash between syncing
+// an entry and writing the head leaves the head one entry behind; that entry is
+// intact and chains to the head, so the head is caught up before appending.
+// Any other disagreement is left for verify to report
+func (l *Log) readHead(f *os.File) (uint64, string, error) {
+	last, err := lastEntry(f)
+	if err != nil {
+		return 0, "", fmt.Errorf("audit log %s is corrupted, run audit verify: %w", l.path, err)
+	}
+	seq, hash, _, err := readHeadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// no head yet: a new log, or one written before the head existed
+		return last.Seq, last.Hash, nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if last.Seq == seq+1 && last.Prev == hash && l.intact(last) {
+		if err := l.writeHead(last); err != nil {
+			return 0, "", err
+		}
+		return last.Seq, last.Hash, nil
+	}
+	return seq, hash, nil
+}
+
+// an entry whose hash (and with a key, MAC) checks out
+func (l *Log) intact(e Entry) bool {
+	if sum, err := entryHash(e); err != nil || sum != e.Hash {
+		return false
+	}
+	return l.key == nil || validMac(l.key, e.Hash, e.Mac)
+}
+
+func readHeadFile(path string) (seq uint64, hash, mac string, err error) {
+	data, err := os.ReadFile(headPath(path))
+	if err != nil {
+		return 0, "", "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, "", "", fmt.Errorf("malformed audit head file %s", headPath(path))
+	}
+	seq, err = strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("malformed audit head file %s", headPath(path))
+	}
+	if len(fields) > 2 {
+		mac = fields[2]
+	}
+	return seq, fields[1], mac, nil
+}
+
+func (l *Log) writeHead(e Entry) error {
+	head := fmt.Sprintf("%d %s", e.Seq, e.Hash)
+	if l.key != nil {
+		head += " " + sign(l.key, head)
+	}
+	tmp := headPath(l.path) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(head+"\n"), 0600); err != nil {
+		return fmt.Errorf("audit head: %w", err)
+	}
+	if err := os.Rename(tmp, headPath(l.path)); err != nil {
+		return fmt.Errorf("audit head: %w", err)
+	}
+	return nil
+}
+
+// reading the last entry of the log, scanning back from its end so a long log
+// isn't read whole on every append. An empty log gives the zero entry
+func lastEntry(f *os.File) (Entry, error) {
+	var last Entry
+	info, err := f.Stat()
+	if err != nil {
+		return last, err
+	}
+	const block = 4096
+	var tail []byte
+	for off := info.Size(); off > 0; {
+		n := int64(block)
+		if off < n {
+			n = off
+		}
+		off -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, off); err != nil {
+			return last, err
+		}
+		tail = append(buf, tail...)
+		// a newline before the last non-empty line means the line is complete
+		trimmed := bytes.TrimRight(tail, " \t\r\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			tail = trimmed[i+1:]
+			break
+		}
+		if len(tail) > 1<<20 {
+			return last, errors.New("last entry is longer than 1 MiB")
+		}
+	}
+	tail = bytes.TrimSpace(tail)
+	if len(tail) == 0 {
+		return last, nil
+	}
+	err = json.Unmarshal(tail, &last)
+	return last, err
+}
+
+// one JSON line, without escaping <, > and & so targets stay readable
+func marshalEntry(e Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hash of the entry with its hash and mac left out
+func entryHash(e Entry) (string, error) {
+	e.Hash, e.Mac = "", ""
+	data, err := marshalEntry(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes.TrimSuffix(data, []byte("\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sign(key []byte, msg string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(msg))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func validMac(key []byte, msg, mac string) bool {
+	return hmac.Equal([]byte(sign(key, msg)), []byte(strings.ToLower(mac)))
+}
+
+// creating func to check the whole chain of the log at path
+// with a key every MAC is checked too, without one only the hash chain is
+func Verify(path string, key []byte) (Report, error) {
+	var rep Report
+	f, err := os.Open(path)
+	if err != nil {
+		return rep, err
+	}
+	defer f.Close()
+
+	problem := func(line int, format string, args ...any) {
+		rep.Problems = append(rep.Problems, Problem{Line: line, Reason: fmt.Sprintf(format, args...)})
+	}
+	rep.Signed = key != nil
+	var prev Entry
+	lineNo := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			problem(lineNo, "not a valid entry: %v", err)
+			// the rest can't be chained to anything
+			return rep, nil
+		}
+		rep.Entries++
+		if e.Seq != prev.Seq+1 {
+			problem(lineNo, "sequence number %d, expected %d (entries removed or reordered)", e.Seq, prev.Seq+1)
+		}
+		if e.Prev != prev.Hash {
+			problem(lineNo, "previous-hash link broken (an earlier entry was changed or removed)")
+		}
+		if sum, err := entryHash(e); err != nil || sum != e.Hash {
+			problem(lineNo, "entry %d was modified (hash mismatch)", e.Seq)
+		}
+		switch {
+		case key == nil:
+		case e.Mac == "":
+			problem(lineNo, "entry %d is not signed", e.Seq)
+		case !validMac(key, e.Hash, e.Mac):
+			problem(lineNo, "entry %d has an invalid HMAC (wrong key or forged)", e.Seq)
+		}
+		prev = e
+	}
+	if err := sc.Err(); err != nil {
+		return rep, err
+	}
+
+	seq, hash, mac, err := readHeadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if rep.Entries > 0 {
+			problem(0, "head file %s is missing, truncation can't be ruled out", headPath(path))
+		}
+		return rep, nil
+	case err != nil:
+		problem(0, "%v", err)
+		return rep, nil
+	}
+	if key != nil && (mac == "" || !validMac(key, fmt.Sprintf("%d %s", seq, hash), mac)) {
+		problem(0, "head file has an invalid HMAC")
+	}
+	switch {
+	case seq > prev.Seq:
+		problem(0, "log is truncated: head records %d entries, the log ends at %d", seq, prev.Seq)
+	case seq < prev.Seq:
+		problem(0, "head records %d entries but the log has %d (entries appended outside the log)", seq, prev.Seq)
+	case hash != prev.Hash:
+		problem(0, "head hash does not match the last entry")
+	}
+	return rep, nil
+}
@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{0x5a}, 32)
+
+// creating func to write n entries to a fresh log, returning its path
+func writeLog(t *testing.T, key []byte, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < n; i++ {
+		// a new Log each time, the chain has to continue across processes
+		l := Open(path, key)
+		err := l.Append(Entry{Command: "run", Op: "encrypt", Target: "file" + string(rune('a'+i)), Result: ResultOK})
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verify(t *testing.T, path string, key []byte) Report {
+	t.Helper()
+	rep, err := Verify(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
+
+// the report must have a problem whose text contains want
+func assertProblem(t *testing.T, rep Report, want string) {
+	t.Helper()
+	for _, p := range rep.Problems {
+		if strings.Contains(p.String(), want) {
+			return
+		}
+	}
+	t.Errorf("no problem mentioning %q in %v", want, rep.Problems)
+}
+
+func TestVerifyIntact(t *testing.T) {
+	path := writeLog(t, testKey, 4)
+	rep := verify(t, path, testKey)
+	if !rep.OK() || rep.Entries != 4 || !rep.Signed {
+		t.Fatalf("signed log: %+v", rep)
+	}
+
+	path = writeLog(t, nil, 3)
+	rep = verify(t, path, nil)
+	if !rep.OK() || rep.Entries != 3 || rep.Signed {
+		t.Fatalf("unsigned log: %+v", rep)
+	}
+}
+
+func TestVerifyModifiedEntry(t *testing.T) {
+	path := writeLog(t, testKey, 3)
+	lines := readLines(t, path)
+	lines[1] = strings.Replace(lines[1], `"target":"fileb"`, `"target":"other"`, 1)
+	writeLines(t, path, lines)
+
+	rep := verify(t, path, testKey)
+	if rep.OK() {
+		t.Fatal("modified entry not detected")
+	}
+	assertProblem(t, rep, "line 2: entry 2 was modified")
+}
+
+func TestVerifyRemovedEntry(t *testing.T) {
+	path := writeLog(t, testKey, 4)
+	lines := readLines(t, path)
+	writeLines(t, path, append(lines[:1:1], lines[2:]...))
+
+	rep := verify(t, path, testKey)
+	assertProblem(t, rep, "sequence number 3, expected 2")
+	assertProblem(t, rep, "previous-hash link broken")
+}
+
+// a cut tail still chains, only the head file catches it
+func TestVerifyTruncated(t *testing.T) {
+	path := writeLog(t, testKey, 4)
+	writeLines(t, path, readLines(t, path)[:2])
+
+	rep := verify(t, path, testKey)
+	assertProblem(t, rep, "log is truncated")
+
+	os.Remove(headPath(path))
+	rep = verify(t, path, testKey)
+	assertProblem(t, rep, "head file")
+}
+
+func TestVerifyKey(t *testing.T) {
+	path := writeLog(t, testKey, 2)
+	rep := verify(t, path, bytes.Repeat([]byte{0x11}, 32))
+	assertProblem(t, rep, "invalid HMAC")
+
+	// the hash chain alone still verifies without the key
+	if rep := verify(t, path, nil); !rep.OK() {
+		t.Errorf("without a key: %v", rep.Problems)
+	}
+
+	unsigned := writeLog(t, nil, 2)
+	rep = verify(t, unsigned, testKey)
+	assertProblem(t, rep, "entry 1 is not signed")
+}
+
+func TestVerifyGarbage(t *testing.T) {
+	path := writeLog(t, testKey, 2)
+	lines := readLines(t, path)
+	writeLines(t, path, append(lines, "not json"))
+	rep := verify(t, path, testKey)
+	assertProblem(t, rep, "line 3: not a valid entry")
+}
+
+// a crash after the entry was synced but before the head was written
+func TestAppendAfterStaleHead(t *testing.T) {
+	path := writeLog(t, testKey, 2)
+	staleHead, err := os.ReadFile(headPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Open(path, testKey)
+	defer l.Close()
+	if err := l.Append(Entry{Command: "run", Op: "encrypt", Result: ResultOK}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(headPath(path), staleHead, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Append(Entry{Command: "run", Op: "decrypt", Result: ResultOK}); err != nil {
+		t.Fatal(err)
+	}
+	rep := verify(t, path, testKey)
+	if !rep.OK() || rep.Entries != 4 {
+		t.Fatalf("after a stale head: %+v", rep)
+	}
+
+	// an entry that doesn't check out is not taken over into the head
+	lines := readLines(t, path)
+	lines = append(lines, strings.Replace(lines[3], `"seq":4`, `"seq":5`, 1))
+	writeLines(t, path, lines)
+	if err := l.Append(Entry{Command: "run", Op: "encrypt", Result: ResultOK}); err != nil {
+		t.Fatal(err)
+	}
+	rep = verify(t, path, testKey)
+	assertProblem(t, rep, "entry 5 was modified")
+}
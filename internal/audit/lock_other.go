@@ -0,0 +1,10 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// no file locking here, appends are only serialized within one process
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) {}
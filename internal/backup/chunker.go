@@ -0,0 +1,133 @@
+package backup
+
+// content-defined chunking with a gear rolling hash (as in FastCDC).
+// a cut is made where the low bits of the rolling hash are all zero, so
+// boundaries depend on the content around them and not on file offsets:
+// inserting a byte early in a file only changes the chunks next to it
+// and everything after still deduplicates.
+//
+// the gear table is derived from the repository key, so chunk sizes don't
+// leak which well-known files are stored
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"example.com/crypto-cli/utils"
+)
+
+// chunk size bounds in bytes, Avg must be a power of two
+type ChunkerParams struct {
+	Min int `yaml:"min"`
+	Avg int `yaml:"avg"`
+	Max int `yaml:"max"`
+}
+
+var DefaultChunkerParams = ChunkerParams{Min: 256 << 10, Avg: 1 << 20, Max: 4 << 20}
+
+func (p ChunkerParams) Validate() error {
+	if p.Min < 64 || p.Avg <= p.Min || p.Max <= p.Avg {
+		return fmt.Errorf("chunker sizes must satisfy 64 <= min < avg < max (got %d/%d/%d)", p.Min, p.Avg, p.Max)
+	}
+	if bits.OnesCount(uint(p.Avg)) != 1 {
+		return fmt.Errorf("average chunk size %d is not a power of two", p.Avg)
+	}
+	return nil
+}
+
+type GearTable [256]uint64
+
+// creating func to derive a gear table from a secret seed
+func NewGearTable(seed []byte) (*GearTable, error) {
+	raw, err := utils.HKDF(seed, nil, "crypto-cli backup gear v1", 256*8)
+	if err != nil {
+		return nil, err
+	}
+	var g GearTable
+	for i := range g {
+		g[i] = binary.LittleEndian.Uint64(raw[i*8:])
+	}
+	return &g, nil
+}
+
+type Chunker struct {
+	r     io.Reader
+	gear  *GearTable
+	p     ChunkerParams
+	mask  uint64
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+// creating func to split everything read from r into chunks
+func NewChunker(r io.Reader, gear *GearTable, p ChunkerParams) *Chunker {
+	return &Chunker{
+		r:    r,
+		gear: gear,
+		p:    p,
+		mask: uint64(p.Avg - 1),
+		buf:  make([]byte, 2*p.Max),
+	}
+}
+
+// creating func to return the next chunk, or io.EOF after the last one
+// the slice is only valid until the next call
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	n := c.end - c.start
+	if n == 0 {
+		return nil, io.EOF
+	}
+	data := c.buf[c.start:c.end]
+	cut := n
+	if n > c.p.Max {
+		cut = c.p.Max
+	}
+	if n > c.p.Min {
+		var h uint64
+		limit := cut
+		for i := c.p.Min; i < limit; i++ {
+			h = (h << 1) + c.gear[data[i]]
+			if h&c.mask == 0 {
+				cut = i + 1
+				break
+			}
+		}
+	}
+	chunk := data[:cut]
+	c.start += cut
+	return chunk, nil
+}
+
+// keeps at least Max bytes buffered unless the reader is done
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.p.Max {
+		return nil
+	}
+	if c.start > 0 {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+	}
+	for c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c.end >= c.p.Max {
+			return nil
+		}
+	}
+	return nil
+}
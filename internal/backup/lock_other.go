@@ -0,0 +1,10 @@
+//go:build !unix
+
+package backup
+
+import "os"
+
+// no file locking here, don't prune while another process backs up to the repository
+func lockFile(f *os.File, exclusive bool) error { return nil }
+
+func unlockFile(f *os.File) {}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package backup
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// taking the repository lock, shared for backups and restores, exclusive for prune
+func lockFile(f *os.File, exclusive bool) error {
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	return unix.Flock(int(f.Fd()), how)
+}
+
+func unlockFile(f *os.File) {
+	unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
@@ -0,0 +1,297 @@
+package backup
+
+// a deduplicating, encrypted backup repository in a local directory:
+//
+//   <repo>/config.yaml           repository settings, salt and key check (not secret)
+//   <repo>/chunks/ab/abcd...     one encrypted chunk per unique chunk ID
+//   <repo>/snapshots/<id>        one encrypted snapshot manifest per backup run
+//   <repo>/lock                  flock'ed: shared by backups and restores, exclusive by prune,
+//                                so a prune never deletes chunks a running backup relies on
+//
+// everything is derived from one master key (a password through Argon2id, or a
+// raw key from a keyfile or the keystore) with HKDF, bound to the repository ID:
+// the encryption subkey feeds the plugin, the MAC subkey gives the chunk IDs
+// (HMAC-SHA256 of the plaintext, so equal chunks dedupe without revealing their
+// hash) and the naming subkey seeds the chunker's gear table
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/crypto-cli/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	repoVersion    = 1
+	configFileName = "config.yaml"
+	chunksDir      = "chunks"
+	snapshotsDir   = "snapshots"
+	lockFileName   = "lock"
+	keyCheckInput  = "crypto-cli backup key check v1"
+	// config, chunks and snapshots are only for the owner
+	repoFilePerm = 0600
+)
+
+var ErrWrongKey = errors.New("wrong password or key for this repository")
+
+// on-disk repository settings
+type RepoConfig struct {
+	Version  int                 `yaml:"version"`
+	ID       string              `yaml:"id"`
+	Scheme   string              `yaml:"scheme"`
+	KDF      string              `yaml:"kdf"`
+	Salt     string              `yaml:"salt,omitempty"`
+	Argon2   *utils.Argon2Params `yaml:"argon2,omitempty"`
+	Chunker  ChunkerParams       `yaml:"chunker"`
+	KeyCheck string              `yaml:"key_check"`
+	Created  time.Time           `yaml:"created"`
+}
+
+// the secret that unlocks a repository, exactly one field is set
+type KeyMaterial struct {
+	Password []byte
+	Key      []byte
+}
+
+type Repository struct {
+	Dir    string
+	Config RepoConfig
+	plugin utils.Plugin
+	encKey *utils.SecretBuffer
+	macKey *utils.SecretBuffer
+	gear   *GearTable
+}
+
+// creating func to tell whether dir already holds a repository
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, configFileName))
+	return err == nil
+}
+
+// creating func to initialise a new repository in dir
+func Init(dir, scheme string, km KeyMaterial, params ChunkerParams) (*Repository, error) {
+	if Exists(dir) {
+		return nil, fmt.Errorf("%s already contains a repository", dir)
+	}
+	if _, ok := utils.GetPlugin(scheme); !ok {
+		return nil, utils.UnsupportedSchemeError(scheme)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cfg := RepoConfig{
+		Version: repoVersion,
+		ID:      hex.EncodeToString(id),
+		Scheme:  scheme,
+		KDF:     "key",
+		Chunker: params,
+		Created: time.Now().UTC(),
+	}
+	if km.Password != nil {
+		salt, err := utils.GenerateSalt()
+		if err != nil {
+			return nil, err
+		}
+		argon := utils.DefaultArgon2Params
+		cfg.KDF = "argon2id"
+		cfg.Salt = hex.EncodeToString(salt)
+		cfg.Argon2 = &argon
+	}
+
+	repo := &Repository{Dir: dir, Config: cfg}
+	if err := repo.unlock(km); err != nil {
+		return nil, err
+	}
+	repo.Config.KeyCheck = repo.keyCheck()
+
+	for _, sub := range []string{chunksDir, snapshotsDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			repo.Close()
+			return nil, err
+		}
+	}
+	data, err := yaml.Marshal(&repo.Config)
+	if err == nil {
+		err = utils.WriteFileAtomic(filepath.Join(dir, configFileName), data, utils.WriteOptions{Perm: repoFilePerm, Replace: true})
+	}
+	if err != nil {
+		repo.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// creating func to open an existing repository, failing early on a wrong key
+func Open(dir string, km KeyMaterial) (*Repository, error) {
+	data, err := os.ReadFile(filepath.Join(dir, configFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no repository found in %s", dir)
+		}
+		return nil, err
+	}
+	var cfg RepoConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid repository config: %v", err)
+	}
+	if cfg.Version != repoVersion {
+		return nil, fmt.Errorf("unsupported repository version %d", cfg.Version)
+	}
+	if err := cfg.Chunker.Validate(); err != nil {
+		return nil, err
+	}
+	repo := &Repository{Dir: dir, Config: cfg}
+	if err := repo.unlock(km); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(repo.keyCheck()), []byte(cfg.KeyCheck)) {
+		repo.Close()
+		return nil, ErrWrongKey
+	}
+	return repo, nil
+}
+
+// deriving the master key and the subkeys
+func (r *Repository) unlock(km KeyMaterial) error {
+	plugin, ok := utils.GetPlugin(r.Config.Scheme)
+	if !ok {
+		return utils.UnsupportedSchemeError(r.Config.Scheme)
+	}
+	r.plugin = plugin
+
+	var master []byte
+	switch {
+	case r.Config.KDF == "argon2id":
+		if km.Password == nil {
+			return fmt.Errorf("this repository is protected by a password")
+		}
+		salt, err := hex.DecodeString(r.Config.Salt)
+		if err != nil || r.Config.Argon2 == nil {
+			return fmt.Errorf("invalid repository key settings")
+		}
+		if master, err = utils.DeriveArgon2id(km.Password, salt, *r.Config.Argon2, 32); err != nil {
+			return err
+		}
+	case r.Config.KDF == "key":
+		if km.Key == nil {
+			return fmt.Errorf("this repository is protected by a key, use --keyfile or --key-id")
+		}
+		if len(km.Key) < 16 {
+			return fmt.Errorf("repository keys must be at least 16 bytes")
+		}
+		master = append([]byte(nil), km.Key...)
+	default:
+		return fmt.Errorf("unsupported repository kdf: %s", r.Config.KDF)
+	}
+	defer utils.Wipe(master)
+
+	sk, err := utils.DeriveSubkeys(master, "backup:"+r.Config.ID, r.Config.Scheme)
+	if err != nil {
+		return err
+	}
+	r.encKey = utils.NewSecretBufferFrom(sk.Encryption)
+	r.macKey = utils.NewSecretBufferFrom(sk.MAC)
+	r.gear, err = NewGearTable(sk.Naming)
+	utils.Wipe(sk.Naming)
+	return err
+}
+
+// creating func to take the repository lock, the returned func releases it
+// exclusive waits for every shared holder to finish, and keeps new ones out
+func (r *Repository) lock(exclusive bool) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(r.Dir, lockFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("locking the repository: %w", err)
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking the repository: %w", err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// creating func to wipe the repository keys
+func (r *Repository) Close() {
+	if r.encKey != nil {
+		r.encKey.Destroy()
+	}
+	if r.macKey != nil {
+		r.macKey.Destroy()
+	}
+}
+
+func (r *Repository) keyCheck() string {
+	return hex.EncodeToString(r.mac([]byte(keyCheckInput)))
+}
+
+func (r *Repository) mac(data []byte) []byte {
+	m := hmac.New(sha256.New, r.macKey.Bytes())
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// creating func to compute the keyed ID of a chunk
+func (r *Repository) ChunkID(data []byte) string {
+	return hex.EncodeToString(r.mac(data))
+}
+
+func (r *Repository) chunkPath(id string) string {
+	return filepath.Join(r.Dir, chunksDir, id[:2], id)
+}
+
+// creating func to store a chunk unless it is already there
+// returns the chunk ID and whether it was new
+func (r *Repository) PutChunk(data []byte) (string, bool, error) {
+	id := r.ChunkID(data)
+	path := r.chunkPath(id)
+	if _, err := os.Stat(path); err == nil {
+		return id, false, nil
+	}
+	enc, err := r.plugin.Encrypt(data, r.encKey.Bytes())
+	if err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", false, err
+	}
+	// a chunk written in the meantime by another backup has the same content
+	if err := utils.WriteFileAtomic(path, []byte(enc), utils.WriteOptions{Perm: repoFilePerm, Replace: true}); err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// creating func to read, decrypt and authenticate a chunk
+func (r *Repository) GetChunk(id string) ([]byte, error) {
+	if len(id) != sha256.Size*2 {
+		return nil, fmt.Errorf("invalid chunk id %q", id)
+	}
+	enc, err := os.ReadFile(r.chunkPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", id, err)
+	}
+	data, err := r.plugin.Decrypt(string(enc), r.encKey.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %v", id, err)
+	}
+	// the ID is a MAC of the plaintext, so this also catches tampering with unauthenticated schemes
+	if !hmac.Equal([]byte(r.ChunkID(data)), []byte(id)) {
+		return nil, fmt.Errorf("chunk %s is corrupted", id)
+	}
+	return data, nil
+}
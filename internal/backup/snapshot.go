@@ -0,0 +1,397 @@
+package backup
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/crypto-cli/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// one file in a snapshot, Chunks are the chunk IDs in order
+type FileEntry struct {
+	Path    string      `yaml:"path"`
+	Mode    fs.FileMode `yaml:"mode"`
+	ModTime time.Time   `yaml:"mtime"`
+	Size    int64       `yaml:"size"`
+	Chunks  []string    `yaml:"chunks"`
+}
+
+// the manifest of one backup run, stored encrypted
+type Snapshot struct {
+	ID    string      `yaml:"id"`
+	Time  time.Time   `yaml:"time"`
+	Host  string      `yaml:"host"`
+	Paths []string    `yaml:"paths"`
+	Size  int64       `yaml:"size"`
+	Files []FileEntry `yaml:"files"`
+}
+
+// on-disk wrapper, Mac authenticates the plaintext manifest for every scheme
+type sealedSnapshot struct {
+	Mac  string `yaml:"mac"`
+	Data string `yaml:"data"`
+}
+
+// counters reported by create
+type CreateStats struct {
+	Files      int
+	Bytes      int64
+	Chunks     int
+	NewChunks  int
+	NewBytes   int64
+	FailedPath []string
+}
+
+// counters reported by prune
+type PruneStats struct {
+	Snapshots  []string
+	Chunks     int
+	FreedBytes int64
+	KeptChunks int
+	DryRun     bool
+}
+
+// creating func to back up files, directories and globs into a new snapshot
+// files that can't be read are skipped and listed in the stats, the rest still gets saved.
+// progress (when not nil) receives every byte read
+func (r *Repository) Create(paths []string, progress io.Writer) (*Snapshot, CreateStats, error) {
+	var stats CreateStats
+	// chunks that are already there are not written again, a prune must not
+	// remove them before the snapshot referring to them is saved
+	unlock, err := r.lock(false)
+	if err != nil {
+		return nil, stats, err
+	}
+	defer unlock()
+	files, err := utils.CollectFiles(paths)
+	if err != nil {
+		return nil, stats, err
+	}
+	id, err := newSnapshotID()
+	if err != nil {
+		return nil, stats, err
+	}
+	host, _ := os.Hostname()
+	snap := &Snapshot{ID: id, Time: time.Now().UTC(), Host: host, Paths: paths}
+
+	for _, path := range files {
+		entry, err := r.backupFile(path, progress, &stats)
+		if err != nil {
+			utils.Warn("skipping %s: %v", path, err)
+			stats.FailedPath = append(stats.FailedPath, path)
+			continue
+		}
+		snap.Files = append(snap.Files, entry)
+		snap.Size += entry.Size
+		stats.Files++
+		stats.Bytes += entry.Size
+	}
+	if err := r.SaveSnapshot(snap); err != nil {
+		return nil, stats, err
+	}
+	return snap, stats, nil
+}
+
+func (r *Repository) backupFile(path string, progress io.Writer, stats *CreateStats) (FileEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return FileEntry{}, err
+	}
+	entry := FileEntry{
+		Path:    filepath.ToSlash(filepath.Clean(path)),
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime().UTC(),
+	}
+	var src io.Reader = f
+	if progress != nil {
+		src = io.TeeReader(f, progress)
+	}
+	chunker := NewChunker(src, r.gear, r.Config.Chunker)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return FileEntry{}, err
+		}
+		id, added, err := r.PutChunk(chunk)
+		if err != nil {
+			return FileEntry{}, err
+		}
+		entry.Chunks = append(entry.Chunks, id)
+		entry.Size += int64(len(chunk))
+		stats.Chunks++
+		if added {
+			stats.NewChunks++
+			stats.NewBytes += int64(len(chunk))
+		}
+	}
+	return entry, nil
+}
+
+// snapshot IDs sort by creation time: 20261019-101500-1a2b3c4d
+func newSnapshotID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+// creating func to encrypt and store a snapshot manifest
+func (r *Repository) SaveSnapshot(s *Snapshot) error {
+	plain, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	defer utils.Wipe(plain)
+	enc, err := r.plugin.Encrypt(plain, r.encKey.Bytes())
+	if err != nil {
+		return err
+	}
+	sealed, err := yaml.Marshal(sealedSnapshot{Mac: hex.EncodeToString(r.mac(plain)), Data: enc})
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(r.Dir, snapshotsDir, s.ID), sealed, utils.WriteOptions{Perm: repoFilePerm})
+}
+
+// creating func to load and decrypt one snapshot, "latest" picks the newest
+func (r *Repository) LoadSnapshot(id string) (*Snapshot, error) {
+	if id == "latest" {
+		ids, err := r.snapshotIDs()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("repository has no snapshots")
+		}
+		id = ids[len(ids)-1]
+	}
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(r.Dir, snapshotsDir, id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("snapshot %s not found", id)
+		}
+		return nil, err
+	}
+	var sealed sealedSnapshot
+	if err := yaml.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %v", id, err)
+	}
+	plain, err := r.plugin.Decrypt(sealed.Data, r.encKey.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %v", id, err)
+	}
+	defer utils.Wipe(plain)
+	if !hmac.Equal([]byte(hex.EncodeToString(r.mac(plain))), []byte(sealed.Mac)) {
+		return nil, fmt.Errorf("snapshot %s is corrupted", id)
+	}
+	var s Snapshot
+	if err := yaml.Unmarshal(plain, &s); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %v", id, err)
+	}
+	return &s, nil
+}
+
+func (r *Repository) snapshotIDs() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.Dir, snapshotsDir))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			ids = append(ids, e.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// creating func to load every snapshot, oldest first
+func (r *Repository) ListSnapshots() ([]*Snapshot, error) {
+	ids, err := r.snapshotIDs()
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]*Snapshot, 0, len(ids))
+	for _, id := range ids {
+		s, err := r.LoadSnapshot(id)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, s)
+	}
+	return snaps, nil
+}
+
+// the write options of a restored file, the caller applies its overwrite policy
+type RestoreOptions func(dest string, entry FileEntry) (utils.WriteOptions, error)
+
+// creating func to restore a snapshot below target
+// only paths under target are ever written, whatever the snapshot says
+func (r *Repository) Restore(s *Snapshot, target string, options RestoreOptions, progress io.Writer) (int, error) {
+	restored := 0
+	unlock, err := r.lock(false)
+	if err != nil {
+		return restored, err
+	}
+	defer unlock()
+	for _, entry := range s.Files {
+		dest, err := restorePath(target, entry.Path)
+		if err != nil {
+			return restored, err
+		}
+		if err := r.restoreFile(entry, dest, options, progress); err != nil {
+			return restored, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// maps a stored path to a path below target
+// like tar, leading "/" and "../" are dropped, so nothing can land outside target
+func restorePath(target, stored string) (string, error) {
+	rel := filepath.FromSlash(stored)
+	if vol := filepath.VolumeName(rel); vol != "" {
+		rel = rel[len(vol):]
+	}
+	// Clean moves every ".." to the front, where it is trimmed off
+	rel = filepath.Clean(string(filepath.Separator) + rel)
+	rel = strings.TrimLeft(rel, `\/`)
+	if rel == "" || rel == "." {
+		return "", fmt.Errorf("refusing to restore %q: empty path", stored)
+	}
+	return filepath.Join(target, rel), nil
+}
+
+func (r *Repository) restoreFile(entry FileEntry, dest string, options RestoreOptions, progress io.Writer) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	opts, err := options(dest, entry)
+	if err != nil {
+		return err
+	}
+	f, err := utils.CreateAtomic(dest, opts)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	for _, id := range entry.Chunks {
+		data, err := r.GetChunk(id)
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		if err == nil && progress != nil {
+			_, err = progress.Write(data)
+		}
+		utils.Wipe(data)
+		if err != nil {
+			return err
+		}
+	}
+	return f.Commit()
+}
+
+// creating func to forget snapshots and delete chunks nothing refers to anymore
+// keepLast > 0 keeps only the newest keepLast snapshots, forget lists extra IDs to drop
+func (r *Repository) Prune(keepLast int, forget []string, dryRun bool) (PruneStats, error) {
+	stats := PruneStats{DryRun: dryRun}
+	// the live set is only complete while no backup can add a snapshot
+	unlock, err := r.lock(true)
+	if err != nil {
+		return stats, err
+	}
+	defer unlock()
+	ids, err := r.snapshotIDs()
+	if err != nil {
+		return stats, err
+	}
+	drop := make(map[string]bool)
+	for _, id := range forget {
+		found := false
+		for _, known := range ids {
+			if known == id {
+				found = true
+			}
+		}
+		if !found {
+			return stats, fmt.Errorf("snapshot %s not found", id)
+		}
+		drop[id] = true
+	}
+	if keepLast > 0 && len(ids) > keepLast {
+		for _, id := range ids[:len(ids)-keepLast] {
+			drop[id] = true
+		}
+	}
+
+	// every chunk referenced by a snapshot we keep stays
+	live := make(map[string]bool)
+	for _, id := range ids {
+		if drop[id] {
+			stats.Snapshots = append(stats.Snapshots, id)
+			continue
+		}
+		s, err := r.LoadSnapshot(id)
+		if err != nil {
+			return stats, fmt.Errorf("refusing to prune: %v", err)
+		}
+		for _, f := range s.Files {
+			for _, c := range f.Chunks {
+				live[c] = true
+			}
+		}
+	}
+
+	if !dryRun {
+		for _, id := range stats.Snapshots {
+			if err := os.Remove(filepath.Join(r.Dir, snapshotsDir, id)); err != nil {
+				return stats, err
+			}
+		}
+	}
+	err = filepath.WalkDir(filepath.Join(r.Dir, chunksDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		if live[d.Name()] {
+			stats.KeptChunks++
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.Chunks++
+		stats.FreedBytes += info.Size()
+		if dryRun {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	return stats, err
+}
@@ -12,15 +12,59 @@ type FileTask struct {
 	Files []string `yaml:"files"`
 }
 
+// rules applied to passwords used for encryption
+// Action is "reject" to refuse weak passwords or "warn" to only log a warning
+type PasswordPolicy struct {
+	MinEntropy      float64 `yaml:"min_entropy"`
+	MinLength       int     `yaml:"min_length"`
+	BannedWordsFile string  `yaml:"banned_words_file"`
+	Action          string  `yaml:"action"`
+}
+
 type Config struct {
-	DefaultScheme   string   `yaml:"default_scheme"`
-	Concurrent      bool     `yaml:"concurrent"`
-	DefaultPassword string   `yaml:"default_password"`
-	LogLevel        string   `yaml:"log_level"`
-	FileTask        FileTask `yaml:"file_task"`
-	Salt            string   `yaml:"salt"`
-	Input           string   `yaml:"input"`
-	Output          string   `yaml:"output"`
+	DefaultScheme   string         `yaml:"default_scheme"`
+	Concurrent      bool           `yaml:"concurrent"`
+	DefaultPassword string         `yaml:"default_password"`
+	LogLevel        string         `yaml:"log_level"`
+	FileTask        FileTask       `yaml:"file_task"`
+	Salt            string         `yaml:"salt"`
+	Input           string         `yaml:"input"`
+	Output          string         `yaml:"output"`
+	PasswordPolicy  PasswordPolicy `yaml:"password_policy"`
+}
+
+// default policy when the config file leaves fields empty
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinEntropy: 40,
+		MinLength:  8,
+		Action:     "warn",
+	}
+}
+
+// filling empty policy fields from the defaults
+func (p PasswordPolicy) WithDefaults() PasswordPolicy {
+	def := DefaultPasswordPolicy()
+	if p.MinEntropy == 0 {
+		p.MinEntropy = def.MinEntropy
+	}
+	if p.MinLength == 0 {
+		p.MinLength = def.MinLength
+	}
+	if p.Action == "" {
+		p.Action = def.Action
+	}
+	return p
+}
+
+// creating func to check the policy, an action other than warn or reject
+// (a typo like "rejct") would otherwise quietly let weak passwords through
+func (p PasswordPolicy) Validate() error {
+	switch p.Action {
+	case "", "warn", "reject":
+		return nil
+	}
+	return fmt.Errorf("unknown password_policy action: %q (choose warn or reject)", p.Action)
 }
 
 // more changes will be made for reading commands from configuration files
@@ -34,5 +78,8 @@ func LoadConfig(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &AppConfig); err != nil {
 		return nil, fmt.Errorf("couldn't parse config file: %w", err)
 	}
+	if err := AppConfig.PasswordPolicy.Validate(); err != nil {
+		return nil, err
+	}
 	return &AppConfig, nil
 }
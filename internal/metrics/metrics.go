@@ -0,0 +1,313 @@
+package metrics
+
+// counters, gauges and latency histograms for batch runs, exported in the
+// Prometheus text format (for the node_exporter textfile collector) or in
+// OpenMetrics (for scrapers that ask for it on /metrics).
+//
+// the set of metrics is fixed and small, so it is kept here instead of pulling
+// in the Prometheus client library. Nothing is recorded until Enable is called,
+// so commands run without --metrics-addr or --metrics-file pay only a bool check
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upper bounds in seconds of the latency histogram buckets
+var latencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// metric families, written in this order
+const (
+	famBytes       = "cryptocli_bytes"
+	famOperations  = "cryptocli_operations"
+	famErrors      = "cryptocli_errors"
+	famDuration    = "cryptocli_operation_duration_seconds"
+	famWorkers     = "cryptocli_workers"
+	famWorkersBusy = "cryptocli_workers_busy"
+	famBusy        = "cryptocli_worker_busy_seconds"
+	famUtilization = "cryptocli_worker_utilization"
+)
+
+type family struct {
+	name string
+	typ  string // counter, gauge or histogram
+	help string
+}
+
+var families = []family{
+	{famBytes, "counter", "Bytes processed, by command, operation and scheme."},
+	{famOperations, "counter", "Operations (files, strings, hashes) processed, by result."},
+	{famErrors, "counter", "Failed operations by error code."},
+	{famDuration, "histogram", "Time taken by one operation."},
+	{famWorkers, "gauge", "Size of the worker pool of the last batch."},
+	{famWorkersBusy, "gauge", "Workers currently processing an item."},
+	{famBusy, "counter", "Time workers spent processing items."},
+	{famUtilization, "gauge", "Busy time divided by the capacity (workers * wall time) of all batches so far."},
+}
+
+type series struct {
+	value   float64
+	buckets []uint64 // histograms only, one count per latencyBuckets entry
+	count   uint64
+}
+
+// per-command worker pool accounting
+type pool struct {
+	workers  int
+	running  int // pools started and not yet ended
+	started  time.Time
+	capacity float64 // worker-seconds of ended batches
+}
+
+var (
+	mu      sync.Mutex
+	enabled bool
+	// family name -> rendered label set -> series
+	data  = map[string]map[string]*series{}
+	pools = map[string]*pool{}
+)
+
+// creating func to start recording, until then every call below is a no-op
+func Enable() {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = true
+}
+
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// creating func to record one finished operation
+// code is empty for a success, otherwise the error code of the result
+func Observe(command, op, scheme, code string, bytes int64, d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return
+	}
+	result := "ok"
+	if code != "" {
+		result = "error"
+		get(famErrors, "command", command, "op", op, "code", code).value++
+	}
+	get(famOperations, "command", command, "op", op, "scheme", scheme, "result", result).value++
+	if bytes > 0 {
+		get(famBytes, "command", command, "op", op, "scheme", scheme).value += float64(bytes)
+	}
+	// operations that weren't timed are left out of the histogram
+	if d > 0 {
+		h := get(famDuration, "command", command, "op", op, "scheme", scheme)
+		secs := d.Seconds()
+		if h.buckets == nil {
+			h.buckets = make([]uint64, len(latencyBuckets))
+		}
+		for i, le := range latencyBuckets {
+			if secs <= le {
+				h.buckets[i]++
+			}
+		}
+		h.value += secs
+		h.count++
+	}
+}
+
+// creating func to mark the start of a batch on a pool of workers,
+// the returned func marks its end
+func PoolStart(command string, workers int) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return func() {}
+	}
+	p := pools[command]
+	if p == nil {
+		p = &pool{}
+		pools[command] = p
+	}
+	p.workers = workers
+	if p.running == 0 {
+		p.started = time.Now()
+	}
+	p.running++
+	get(famWorkers, "command", command).value = float64(workers)
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		p.running--
+		if p.running == 0 {
+			p.capacity += float64(p.workers) * time.Since(p.started).Seconds()
+		}
+	}
+}
+
+// creating func to mark a worker as busy, the returned func marks it idle again
+func WorkerStart(command string) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return func() {}
+	}
+	start := time.Now()
+	get(famWorkersBusy, "command", command).value++
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		get(famWorkersBusy, "command", command).value--
+		get(famBusy, "command", command).value += time.Since(start).Seconds()
+	}
+}
+
+// creating func to add busy time measured elsewhere (e.g. per-file durations of a hash batch)
+func AddBusy(command string, d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return
+	}
+	get(famBusy, "command", command).value += d.Seconds()
+}
+
+// the series of a family for the label pairs, created on first use
+// must be called with mu held
+func get(name string, labelPairs ...string) *series {
+	m := data[name]
+	if m == nil {
+		m = map[string]*series{}
+		data[name] = m
+	}
+	key := renderLabels(labelPairs)
+	s := m[key]
+	if s == nil {
+		s = &series{}
+		m[key] = s
+	}
+	return s
+}
+
+func renderLabels(pairs []string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+escape(pairs[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string { return escaper.Replace(s) }
+
+// creating func to write every metric to w
+// openMetrics selects the OpenMetrics 1.0 format, otherwise the Prometheus text format 0.0.4 is used
+func Write(w io.Writer, openMetrics bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+	updateUtilization()
+
+	var b strings.Builder
+	for _, f := range families {
+		m := data[f.name]
+		if len(m) == 0 {
+			continue
+		}
+		// counters are named without _total in OpenMetrics, the samples keep it
+		famName, sample := f.name, f.name
+		if f.typ == "counter" {
+			sample += "_total"
+			if !openMetrics {
+				famName = sample
+			}
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", famName, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", famName, f.typ)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := m[k]
+			if f.typ != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", sample, braces(k), formatFloat(s.value))
+				continue
+			}
+			for i, le := range latencyBuckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, braces(join(k, `le="`+formatFloat(le)+`"`)), s.buckets[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, braces(join(k, `le="+Inf"`)), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, braces(k), formatFloat(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, braces(k), s.count)
+		}
+	}
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// busy time over capacity per command, including a batch that is still running
+// must be called with mu held
+func updateUtilization() {
+	for command, p := range pools {
+		capacity := p.capacity
+		if p.running > 0 {
+			capacity += float64(p.workers) * time.Since(p.started).Seconds()
+		}
+		if capacity <= 0 {
+			continue
+		}
+		busy := get(famBusy, "command", command).value
+		get(famUtilization, "command", command).value = math.Min(busy/capacity, 1)
+	}
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func join(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// creating func to write the metrics for the node_exporter textfile collector
+// the file is replaced atomically so the collector never reads half of it
+func WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := Write(tmp, false); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// the collector runs as another user, so the file has to be readable
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,190 @@
+package trace
+
+// FileExporter writes spans in the OTLP/JSON encoding, one
+// ExportTraceServiceRequest per line (the layout of the OpenTelemetry
+// Collector's file exporter), so the file can be replayed into a collector
+// with the otlpjsonfile receiver or read with jq.
+//
+// IDs are hex strings and 64-bit integers are decimal strings, as the OTLP/JSON
+// spec requires
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// spans are written in batches of this size, and at Shutdown
+const fileBatchSize = 512
+
+type FileExporter struct {
+	mu       sync.Mutex
+	f        *os.File
+	service  string
+	pending  []*Span
+	writeErr error
+}
+
+// creating func to append traces to path, service names the resource (service.name)
+func NewFileExporter(path, service string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f, service: service}, nil
+}
+
+func (e *FileExporter) Export(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append(e.pending, s)
+	if len(e.pending) >= fileBatchSize {
+		e.flush()
+	}
+}
+
+// creating func to write the remaining spans and close the file
+// the first write error (of any batch) is returned
+func (e *FileExporter) Shutdown() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flush()
+	if err := e.f.Close(); err != nil && e.writeErr == nil {
+		e.writeErr = err
+	}
+	return e.writeErr
+}
+
+// must be called with mu held
+func (e *FileExporter) flush() {
+	if len(e.pending) == 0 {
+		return
+	}
+	req := e.request(e.pending)
+	e.pending = nil
+	w := bufio.NewWriter(e.f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(req)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil && e.writeErr == nil {
+		e.writeErr = fmt.Errorf("trace file: %w", err)
+	}
+}
+
+// the OTLP/JSON message types, only the fields used here
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// span kind and status codes from the OTLP protobuf enums
+const (
+	spanKindInternal = 1
+	statusOK         = 1
+	statusError      = 2
+)
+
+func (e *FileExporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceID:           s.Trace.String(),
+			SpanID:            s.ID.String(),
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        keyValues(s.Attrs),
+			Status:            otlpStatus{Code: statusOK},
+		}
+		if !s.Parent.IsZero() {
+			o.ParentSpanID = s.Parent.String()
+		}
+		if s.Failed {
+			o.Status = otlpStatus{Code: statusError, Message: s.ErrorMsg}
+		}
+		s.mu.Unlock()
+		out[i] = o
+	}
+	resource := []Attr{String("service.name", e.service)}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: keyValues(resource)},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: e.service}, Spans: out}},
+	}}}
+}
+
+func keyValues(attrs []Attr) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch x := a.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &x
+		case bool:
+			v.BoolValue = &x
+		default:
+			s := fmt.Sprint(x)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
@@ -0,0 +1,160 @@
+package trace
+
+// a small tracing layer in the shape of OpenTelemetry: spans with a trace ID,
+// a parent, attributes and a status, started from a context.Context.
+//
+// without an exporter (the default) Start returns a nil *Span and every method
+// on it is a no-op, so instrumented code costs next to nothing. With one, every
+// span is handed to the exporter when it ends; FileExporter writes them as
+// OTLP/JSON
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsZero() bool    { return s == SpanID{} }
+
+// one key/value attribute of a span, Value is a string, int64, float64 or bool
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr        { return Attr{key, value} }
+func Int(key string, value int) Attr       { return Attr{key, int64(value)} }
+func Int64(key string, value int64) Attr   { return Attr{key, value} }
+func Float(key string, value float64) Attr { return Attr{key, value} }
+func Bool(key string, value bool) Attr     { return Attr{key, value} }
+
+// one timed operation
+type Span struct {
+	mu       sync.Mutex
+	Name     string
+	Trace    TraceID
+	ID       SpanID
+	Parent   SpanID
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Failed   bool
+	ErrorMsg string
+	ended    bool
+}
+
+// receives finished spans
+type Exporter interface {
+	Export(s *Span)
+	Shutdown() error
+}
+
+var (
+	mu       sync.RWMutex
+	exporter Exporter
+)
+
+// creating func to install the exporter, nil turns tracing off again
+func SetExporter(e Exporter) {
+	mu.Lock()
+	defer mu.Unlock()
+	exporter = e
+}
+
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return exporter != nil
+}
+
+// creating func to flush and remove the exporter
+func Shutdown() error {
+	mu.Lock()
+	e := exporter
+	exporter = nil
+	mu.Unlock()
+	if e == nil {
+		return nil
+	}
+	return e.Shutdown()
+}
+
+type spanKey struct{}
+
+// the span stored in ctx by Start, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// creating func to start a span as a child of the span in ctx (or a new trace)
+// the returned context carries the new span for the spans started under it
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+	s := &Span{Name: name, Start: time.Now(), Attrs: attrs}
+	if parent := FromContext(ctx); parent != nil {
+		s.Trace = parent.Trace
+		s.Parent = parent.ID
+	} else {
+		rand.Read(s.Trace[:])
+	}
+	rand.Read(s.ID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attrs = append(s.Attrs, attrs...)
+}
+
+// creating func to mark the span as failed, a nil error changes nothing
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Failed = true
+	s.ErrorMsg = err.Error()
+}
+
+// creating func to end the span and hand it to the exporter, only the first call counts
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	mu.RLock()
+	e := exporter
+	mu.RUnlock()
+	if e != nil {
+		e.Export(s)
+	}
+}
+
+// records err (if any) and ends the span, handy with a deferred named error
+func (s *Span) FinishErr(err error) {
+	s.RecordError(err)
+	s.Finish()
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"os"
+
 	"example.com/crypto-cli/cmd"
 	_ "example.com/crypto-cli/plugins"
 	"example.com/crypto-cli/utils"
 )
 
 func main() {
-	defer utils.Cleanup()
-	cmd.Execute()
+	code := cmd.Execute()
+	// os.Exit skips deferred calls, so the log file is closed first
+	utils.Cleanup()
+	os.Exit(code)
 }
@@ -1,6 +1,9 @@
 package plugins
 
 import (
+	"context"
+	"io"
+
 	"example.com/crypto-cli/crypto"
 	"example.com/crypto-cli/utils"
 )
@@ -20,14 +23,38 @@ func (p CBCPlugin) Decrypt(data string, key []byte) ([]byte, error) {
 	if err := utils.ValidateKeyLength(key, "cbc"); err != nil {
 		return nil, err
 	}
-	plain, err := crypto.Decrypt(data, key)
-	return []byte(plain), err
+	return crypto.Decrypt(data, key)
 }
 
 func (p CBCPlugin) Name() string {
 	return "cbc"
 }
 
+// key size in bytes, used by keygen and keyfile validation
+func (p CBCPlugin) KeySize() int {
+	return utils.KeyLen["cbc"]
+}
+
+// opting into per-context subkeys derived with HKDF
+func (p CBCPlugin) UsesSubkeys() bool {
+	return true
+}
+
+// streaming in constant memory, the stream carries no tag (like the base64 format)
+func (p CBCPlugin) EncryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	if err := utils.ValidateKeyLength(key, "cbc"); err != nil {
+		return err
+	}
+	return utils.EncryptCBCStream(ctx, in, out, key)
+}
+
+func (p CBCPlugin) DecryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	if err := utils.ValidateKeyLength(key, "cbc"); err != nil {
+		return err
+	}
+	return utils.DecryptCBCStream(ctx, in, out, key)
+}
+
 func init() {
 	utils.RegisterPlugin("cbc", CBCPlugin{})
 }
\ No newline at end of file
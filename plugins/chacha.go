@@ -2,8 +2,12 @@ package plugins
 
 // this is the chacha20-poly1305 plugin architecture implementation
 import (
+	"context"
+	"io"
+
 	"example.com/crypto-cli/crypto"
 	"example.com/crypto-cli/utils"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 type ChaChaPlugin struct{}
@@ -26,6 +30,44 @@ func (p ChaChaPlugin) Name() string {
 	return "chacha"
 }
 
+// key size in bytes, used by keygen and keyfile validation
+func (p ChaChaPlugin) KeySize() int {
+	return utils.KeyLen["chacha"]
+}
+
+// ciphertext carries an AEAD tag that Decrypt checks
+func (p ChaChaPlugin) Authenticated() bool {
+	return true
+}
+
+// opting into per-context subkeys derived with HKDF
+func (p ChaChaPlugin) UsesSubkeys() bool {
+	return true
+}
+
+// streaming in constant memory as chunks sealed with ChaCha20-Poly1305
+func (p ChaChaPlugin) EncryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	if err := utils.ValidateKeyLength(key, "chacha"); err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return err
+	}
+	return utils.EncryptAEADStream(ctx, aead, in, out)
+}
+
+func (p ChaChaPlugin) DecryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	if err := utils.ValidateKeyLength(key, "chacha"); err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return err
+	}
+	return utils.DecryptAEADStream(ctx, aead, in, out)
+}
+
 func init() {
 	utils.RegisterPlugin("chacha", ChaChaPlugin{})
 }
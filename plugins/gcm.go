@@ -1,6 +1,11 @@
 package plugins
 
 import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+
 	"example.com/crypto-cli/crypto"
 	"example.com/crypto-cli/utils"
 )
@@ -11,20 +16,57 @@ func (p GCMPlugin) Encrypt(data []byte, key []byte) (string, error) {
 	if err := utils.ValidateKeyLength(key, "gcm"); err != nil {
 		return "", err
 	}
-	return crypto.EncryptAesGcm(data, string(key))
+	return crypto.EncryptAesGcm(data, key)
 }
 
 func (p GCMPlugin) Decrypt(data string, key []byte) ([]byte, error) {
 	if err := utils.ValidateKeyLength(key, "gcm"); err != nil {
 		return nil, err
 	}
-	return  crypto.DecryptAesGcm(data, string(key))
+	return crypto.DecryptAesGcm(data, key)
 }
 
 func (p GCMPlugin) Name() string {
 	return "gcm"
 }
 
+// key size in bytes, used by keygen and keyfile validation
+func (p GCMPlugin) KeySize() int {
+	return utils.KeyLen["gcm"]
+}
+
+// ciphertext carries an AEAD tag that Decrypt checks
+func (p GCMPlugin) Authenticated() bool {
+	return true
+}
+
+// streaming in constant memory as chunks sealed with AES-GCM
+func (p GCMPlugin) EncryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	return utils.EncryptAEADStream(ctx, aead, in, out)
+}
+
+func (p GCMPlugin) DecryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	return utils.DecryptAEADStream(ctx, aead, in, out)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if err := utils.ValidateKeyLength(key, "gcm"); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
 
 func init() {
 	utils.RegisterPlugin("gcm", GCMPlugin{})
@@ -0,0 +1,188 @@
+package utils
+
+// outputs are written to a temp file in the target's directory, synced and
+// renamed over the target, so an interrupted run leaves either the old file
+// or the complete new one, never a truncated one. The temp file is created
+// 0600 and only gets its final mode right before the rename, so plaintext is
+// never readable by others while it is being written
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// values of --overwrite
+const (
+	OverwriteNever  = "never"
+	OverwriteAlways = "always"
+	OverwritePrompt = "prompt" // ask on the terminal, replace (as before --overwrite) when there is none
+)
+
+var OverwritePolicies = []string{OverwriteNever, OverwriteAlways, OverwritePrompt}
+
+// default modes of new outputs, plaintext is owner-only
+const (
+	PlaintextPerm  os.FileMode = 0600
+	CiphertextPerm os.FileMode = 0644
+)
+
+// how an atomic write places its file
+type WriteOptions struct {
+	Perm os.FileMode
+	// an existing file may be replaced, see CheckOverwrite. when false the
+	// write fails with ErrExists if the target shows up in the meantime
+	Replace bool
+	// set as the modification time when not zero
+	ModTime time.Time
+}
+
+// only one prompt at a time, workers would otherwise ask over each other
+var promptMu sync.Mutex
+
+// creating func to apply the overwrite policy to path before anything is written
+// it returns whether an existing file may be replaced
+func CheckOverwrite(path, policy string) (bool, error) {
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	switch policy {
+	case OverwriteAlways:
+		return true, nil
+	case OverwriteNever:
+		return false, fmt.Errorf("%w: %s (use --overwrite=always to replace it)", ErrExists, path)
+	case OverwritePrompt:
+		return askOverwrite(path)
+	}
+	return false, fmt.Errorf("unknown overwrite policy: %s (choose %s)", policy, strings.Join(OverwritePolicies, ", "))
+}
+
+func askOverwrite(path string) (bool, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		// scripts and CI jobs keep replacing outputs the way they always have,
+		// --overwrite=never is there for the ones that want to be stopped
+		Info("replacing %s (no terminal to ask, --overwrite=never refuses)", path)
+		return true, nil
+	}
+	var answer string
+	withProgressHidden(func() {
+		fmt.Fprintf(os.Stderr, "overwrite %s? [y/N] ", path)
+		answer, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	})
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, fmt.Errorf("%w: %s (not overwritten)", ErrExists, path)
+}
+
+// an output being written, see CreateAtomic
+type AtomicFile struct {
+	*os.File // the temp file
+	path     string
+	opts     WriteOptions
+	closed   bool
+}
+
+// creating func to start an atomic write of path
+// Commit puts the file in place, Abort (safe to defer) throws it away
+func CreateAtomic(path string, opts WriteOptions) (*AtomicFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: tmp, path: path, opts: opts}, nil
+}
+
+// creating func to sync the temp file, give it its mode and mtime and move it to the target
+func (f *AtomicFile) Commit() error {
+	if f.closed {
+		return errors.New("atomic write already finished")
+	}
+	err := f.Sync()
+	if err == nil {
+		err = f.Chmod(f.opts.Perm)
+	}
+	f.closed = true
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !f.opts.ModTime.IsZero() {
+		err = os.Chtimes(f.Name(), f.opts.ModTime, f.opts.ModTime)
+	}
+	if err == nil {
+		err = f.place()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// moves the temp file to the target, without replacing an existing file unless Replace is set
+func (f *AtomicFile) place() error {
+	if f.opts.Replace {
+		return os.Rename(f.Name(), f.path)
+	}
+	// a hard link fails if the target exists, without the window of a stat before rename
+	err := os.Link(f.Name(), f.path)
+	if err == nil {
+		return os.Remove(f.Name())
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExists, f.path)
+	}
+	// no hard links on this file system
+	if _, serr := os.Lstat(f.path); serr == nil {
+		return fmt.Errorf("%w: %s", ErrExists, f.path)
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+// creating func to throw away an unfinished write, a no-op after Commit
+func (f *AtomicFile) Abort() {
+	if f.closed {
+		return
+	}
+	f.closed = true
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// creating func to write data to path atomically
+func WriteFileAtomic(path string, data []byte, opts WriteOptions) error {
+	f, err := CreateAtomic(path, opts)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// the rename is only durable once the directory is synced, failures are
+// ignored as some systems can't sync a directory
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// nothing but the expected files may be left in dir, no temp files
+func assertDirFiles(t *testing.T, dir string, want ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("files in %s: %v, want %v", dir, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("files in %s: %v, want %v", dir, got, want)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.dec")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := WriteFileAtomic(path, []byte("secret"), WriteOptions{Perm: PlaintextPerm, ModTime: mtime}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "secret" {
+		t.Fatalf("read back %q, %v", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != PlaintextPerm {
+		t.Errorf("mode %v, want %v", info.Mode().Perm(), PlaintextPerm)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("mtime %v, want %v", info.ModTime(), mtime)
+	}
+	assertDirFiles(t, dir, "out.dec")
+}
+
+func TestWriteFileAtomicExisting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.enc")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := WriteFileAtomic(path, []byte("new"), WriteOptions{Perm: CiphertextPerm})
+	if !errors.Is(err, ErrExists) {
+		t.Fatalf("without Replace: got %v, want ErrExists", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Fatalf("existing file changed to %q", data)
+	}
+	assertDirFiles(t, dir, "out.enc")
+
+	if err := WriteFileAtomic(path, []byte("new"), WriteOptions{Perm: CiphertextPerm, Replace: true}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Fatalf("with Replace: read back %q", data)
+	}
+	assertDirFiles(t, dir, "out.enc")
+}
+
+// an aborted write leaves neither the target nor the temp file
+func TestAtomicAbort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.dec")
+	f, err := CreateAtomic(path, WriteOptions{Perm: PlaintextPerm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("half"))
+	// the temp file is owner-only while it is written
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("temp file mode %v, want 0600", info.Mode().Perm())
+	}
+	f.Abort()
+	f.Abort()
+	if err := f.Commit(); err == nil {
+		t.Error("Commit after Abort succeeded")
+	}
+	assertDirFiles(t, dir)
+}
+
+func TestCheckOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	existing := filepath.Join(dir, "existing")
+	if err := os.WriteFile(existing, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range OverwritePolicies {
+		replace, err := CheckOverwrite(missing, policy)
+		if replace || err != nil {
+			t.Errorf("%s on a missing file: %v, %v, want false, nil", policy, replace, err)
+		}
+	}
+	if replace, err := CheckOverwrite(existing, OverwriteAlways); !replace || err != nil {
+		t.Errorf("always: %v, %v, want true, nil", replace, err)
+	}
+	if _, err := CheckOverwrite(existing, OverwriteNever); !errors.Is(err, ErrExists) {
+		t.Errorf("never: got %v, want ErrExists", err)
+	}
+	if _, err := CheckOverwrite(existing, "sometimes"); err == nil || errors.Is(err, ErrExists) {
+		t.Errorf("unknown policy: got %v, want a policy error", err)
+	}
+}
+
+// without a terminal to ask, prompt replaces like it did before --overwrite
+func TestCheckOverwritePromptNoTerminal(t *testing.T) {
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd())) {
+		t.Skip("stdin and stderr are a terminal, the prompt would be shown")
+	}
+	existing := filepath.Join(t.TempDir(), "existing")
+	if err := os.WriteFile(existing, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if replace, err := CheckOverwrite(existing, OverwritePrompt); !replace || err != nil {
+		t.Errorf("prompt: %v, %v, want true, nil", replace, err)
+	}
+}
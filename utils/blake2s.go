@@ -0,0 +1,145 @@
+package utils
+
+// BLAKE2s (RFC 7693) with any output length from 1 to 32 bytes.
+// x/crypto/blake2s only builds the 256 bit hash (and 128 bits when keyed),
+// the digest length is part of the parameter block, so a shorter BLAKE2s is
+// a different hash and not a cut 256 bit one. blake2s-256 still goes through
+// x/crypto, this is used for the other lengths of blake2s-<bits>
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"math/bits"
+)
+
+const (
+	blake2sBlockSize = 64
+	blake2sMaxSize   = 32
+	blake2sMaxKey    = 32
+)
+
+var blake2sIV = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+var blake2sSigma = [10][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+}
+
+type blake2sDigest struct {
+	h      [8]uint32
+	t      uint64 // bytes compressed so far
+	buf    [blake2sBlockSize]byte
+	n      int // bytes in buf
+	size   int
+	key    [blake2sBlockSize]byte
+	keyLen int
+}
+
+// creating func to build a BLAKE2s hash with a size byte digest, keyed when key is not empty
+func newBlake2s(size int, key []byte) (hash.Hash, error) {
+	if size < 1 || size > blake2sMaxSize {
+		return nil, errors.New("blake2s: digest size must be between 1 and 32 bytes")
+	}
+	if len(key) > blake2sMaxKey {
+		return nil, errors.New("blake2s: key is longer than 32 bytes")
+	}
+	d := &blake2sDigest{size: size, keyLen: len(key)}
+	copy(d.key[:], key)
+	d.Reset()
+	return d, nil
+}
+
+func (d *blake2sDigest) Size() int      { return d.size }
+func (d *blake2sDigest) BlockSize() int { return blake2sBlockSize }
+
+func (d *blake2sDigest) Reset() {
+	d.h = blake2sIV
+	// parameter block: digest length, key length, fanout 1, depth 1
+	d.h[0] ^= 0x01010000 ^ uint32(d.keyLen)<<8 ^ uint32(d.size)
+	d.t, d.n = 0, 0
+	if d.keyLen > 0 {
+		// the key is the first block, padded with zeros
+		d.buf = d.key
+		d.n = blake2sBlockSize
+	}
+}
+
+func (d *blake2sDigest) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		// the last block is only compressed in Sum, it gets the final flag
+		if d.n == blake2sBlockSize {
+			d.t += blake2sBlockSize
+			d.compress(false)
+			d.n = 0
+		}
+		c := copy(d.buf[d.n:], p)
+		d.n += c
+		p = p[c:]
+	}
+	return written, nil
+}
+
+func (d *blake2sDigest) Sum(in []byte) []byte {
+	s := *d
+	for i := s.n; i < blake2sBlockSize; i++ {
+		s.buf[i] = 0
+	}
+	s.t += uint64(s.n)
+	s.compress(true)
+	var out [blake2sMaxSize]byte
+	for i, v := range s.h {
+		binary.LittleEndian.PutUint32(out[4*i:], v)
+	}
+	return append(in, out[:d.size]...)
+}
+
+func (d *blake2sDigest) compress(last bool) {
+	var m [16]uint32
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint32(d.buf[4*i:])
+	}
+	var v [16]uint32
+	copy(v[:8], d.h[:])
+	copy(v[8:], blake2sIV[:])
+	v[12] ^= uint32(d.t)
+	v[13] ^= uint32(d.t >> 32)
+	if last {
+		v[14] = ^v[14]
+	}
+	g := func(a, b, c, e int, x, y uint32) {
+		v[a] += v[b] + x
+		v[e] = bits.RotateLeft32(v[e]^v[a], -16)
+		v[c] += v[e]
+		v[b] = bits.RotateLeft32(v[b]^v[c], -12)
+		v[a] += v[b] + y
+		v[e] = bits.RotateLeft32(v[e]^v[a], -8)
+		v[c] += v[e]
+		v[b] = bits.RotateLeft32(v[b]^v[c], -7)
+	}
+	for _, s := range blake2sSigma {
+		g(0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+	for i := range d.h {
+		d.h[i] ^= v[i] ^ v[i+8]
+	}
+}
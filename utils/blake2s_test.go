@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/blake2s"
+)
+
+// message of n bytes, i%251 like the reference generator; 3 is "abc" and 11 "hello world"
+func blake2sMessage(n int) []byte {
+	switch n {
+	case 3:
+		return []byte("abc")
+	case 11:
+		return []byte("hello world")
+	}
+	msg := make([]byte, n)
+	for i := range msg {
+		msg[i] = byte(i % 251)
+	}
+	return msg
+}
+
+// expected digests from Python's hashlib.blake2s(msg, digest_size=size, key=key)
+func TestBlake2sVectors(t *testing.T) {
+	tests := []struct {
+		n    int
+		size int
+		key  string
+		want string
+	}{
+		{0, 32, "", "69217a3079908094e11121d042354a7c1f55b6482ca1a51e1b250dfd1ed0eef9"},
+		{3, 32, "", "508c5e8c327c14e2e1a72ba34eeb452f37458b209ed63a294d999b4c86675982"},
+		{11, 20, "", "5b61362bd56823fd6ed1d3bea2f3ff0d2a0214d7"},
+		{64, 16, "", "dc66ca8f03865801b0ffe06ed8a1a90e"},
+		{65, 1, "", "b1"},
+		{200, 28, "", "dcd646d913286f77fa6bd9b5e1999646a26448e586bcb54462e1d38d"},
+		{11, 8, "6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b", "c6ba26a70984ed54"},
+		{0, 16, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "9536f9b267655743dee97b8a670f9f53"},
+		{64, 32, "000102030405060708090a0b0c0d0e0f", "02ba5ce93a26f31312dd2226e48e522df956817d30e797fc3dd232f6bfb5d6a2"},
+	}
+	for _, tt := range tests {
+		key, _ := hex.DecodeString(tt.key)
+		h, err := newBlake2s(tt.size, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write(blake2sMessage(tt.n))
+		if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+			t.Errorf("blake2s-%d of %d bytes (key %q) = %s, want %s", tt.size*8, tt.n, tt.key, got, tt.want)
+		}
+	}
+}
+
+// the 256 bit hash has to agree with x/crypto whatever the write sizes
+func TestBlake2sMatchesXCrypto(t *testing.T) {
+	for _, n := range []int{0, 1, 63, 64, 65, 128, 129, 1000} {
+		msg := blake2sMessage(n)
+		want := blake2s.Sum256(msg)
+		h, _ := newBlake2s(32, nil)
+		for i := 0; i < len(msg); i += 7 {
+			h.Write(msg[i:min(i+7, len(msg))])
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Errorf("%d bytes: got %x, want %x", n, got, want)
+		}
+	}
+}
+
+func TestBlake2sRegistry(t *testing.T) {
+	h, ok := GetHash("blake2s-160")
+	if !ok || h.Size != 20 {
+		t.Fatalf("blake2s-160 not available: %v %d", ok, h.Size)
+	}
+	for _, bad := range []string{"blake2s-0", "blake2s-264", "blake2s-12"} {
+		if _, ok := GetHash(bad); ok {
+			t.Errorf("%s should not be available", bad)
+		}
+	}
+}
@@ -1,31 +1,68 @@
 package utils
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"os"
+	"path/filepath"
 )
 
 // creating a function to compute the checksum of original input using sha256
 func ComputeSHA256(data []byte) string {
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:])
+	sum, _ := ComputeChecksum(data, "sha256")
+	return sum
+}
+
+// creating a function to compute a hex checksum with any registered hash algorithm
+func ComputeChecksum(data []byte, algo string) (string, error) {
+	sum, err := HashBytes(data, algo)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
 }
 
 // creating func to write checksum files
 // return error value
 // pass in path and string of checksum
 func WriteChecksumFile(path, checksum string) error {
-	return os.WriteFile(path+".sha256", []byte(checksum), 0644)
+	return WriteFileAtomic(path+".sha256", []byte(checksum), WriteOptions{Perm: 0644, Replace: true})
+}
+
+// creating func to write a checksum sidecar in one of the DigestFormats
+// gnu and bsd name the file by its base name, so `sha256sum -c` works from its directory
+func WriteChecksumRecord(path string, rec DigestRecord, format string) error {
+	switch format {
+	case "gnu", "bsd", "json":
+		rec.Path = filepath.Base(path)
+	default:
+		rec.Path = ""
+	}
+	line, err := FormatDigest(rec, format)
+	if err != nil {
+		return err
+	}
+	if format != "text" {
+		line += "\n"
+	}
+	return WriteFileAtomic(path+".sha256", []byte(line), WriteOptions{Perm: 0644, Replace: true})
 }
 
 // creating func to read checksum files
 // return string value and error value
 // pass in string of path
+// any of the DigestFormats is accepted, the hex digest is returned
 func ReadChecksumFile(path string) (string, error) {
 	data, err := os.ReadFile(path + ".sha256")
 	if err != nil {
 		return "", err
 	}
-	return string(data), nil
+	algo, digest, err := ParseDigest(string(data))
+	if err != nil {
+		return "", fmt.Errorf("%s.sha256: %v", path, err)
+	}
+	if algo != "" && algo != "sha256" {
+		return "", fmt.Errorf("%s.sha256 holds a %s digest, expected sha256", path, algo)
+	}
+	return digest, nil
 }
@@ -2,11 +2,8 @@ package utils
 
 import (
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
 const (
@@ -31,12 +28,17 @@ func GenerateSalt() ([]byte, error) {
 }
 
 // creating function to derive the key using pbkdf2 2 create a key from password + salt
-func DeriveKeyWithScheme(password string, salt []byte, scheme string) ([]byte, error) {
+// the key is returned in a SecretBuffer, callers must Destroy it when done
+func DeriveKeyWithScheme(password []byte, salt []byte, scheme string) (*SecretBuffer, error) {
 	length, ok := KeyLen[scheme]
 	if !ok {
-		return nil, fmt.Errorf("unsupported encryption scheme: %s", scheme)
+		return nil, UnsupportedSchemeError(scheme)
+	}
+	key, err := DerivePBKDF2(password, salt, Iterations, length)
+	if err != nil {
+		return nil, err
 	}
-	return pbkdf2.Key([]byte(password), salt, Iterations, length, sha256.New), nil
+	return NewSecretBufferFrom(key), nil
 }
 
 // Creating a function to encode salt as hex string for CLI Friendly output
@@ -52,10 +54,10 @@ func DecodeSalt(saltHex string) ([]byte, error) {
 func ValidateKeyLength(key []byte, scheme string) error {
 	expected, ok := KeyLen[scheme]
 	if !ok {
-		return fmt.Errorf("unsupported encryption scheme: %s", scheme)
+		return UnsupportedSchemeError(scheme)
 	}
 	if len(key) != expected {
-		return fmt.Errorf("invalid key length for %s: expected %d bytes, got %d bytes", scheme, expected, len(key))
+		return fmt.Errorf("%w for %s: expected %d bytes, got %d bytes", ErrKeyLength, scheme, expected, len(key))
 	}
 	return nil
 }
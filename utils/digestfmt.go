@@ -0,0 +1,226 @@
+package utils
+
+// output formats for single digests, used by the hash command and the
+// checksum sidecars:
+//
+//   text       <hex digest>                      (bare digest, the old sidecar format)
+//   gnu        <hex digest>  <path>              (sha256sum)
+//   bsd        SHA256 (<path>) = <hex digest>    (sha256sum --tag)
+//   base64     <base64 digest>
+//   multihash  f<hex multihash>                  (multibase base16, self-describing)
+//   json       {"algorithm":...,"path":...,"size":...,"duration_ms":...,"digest":...}
+//
+// text, base64 and multihash add "  <path>" when a path is set, so batch output stays one line per file
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var DigestFormats = []string{"text", "json", "bsd", "gnu", "base64", "multihash"}
+
+// one digest and what it was computed over
+type DigestRecord struct {
+	Algorithm  string  `json:"algorithm"`
+	Path       string  `json:"path,omitempty"`
+	Size       int64   `json:"size"`
+	DurationMs float64 `json:"duration_ms"`
+	Digest     string  `json:"digest"`
+}
+
+// creating func to build a record from a hashing result
+func NewDigestRecord(algo, path, digest string, size int64, d time.Duration) DigestRecord {
+	return DigestRecord{
+		Algorithm:  algo,
+		Path:       path,
+		Size:       size,
+		DurationMs: float64(d.Microseconds()) / 1000,
+		Digest:     digest,
+	}
+}
+
+// creating func to check a format name
+func ValidDigestFormat(format string) error {
+	for _, f := range DigestFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format: %s (choose %s)", format, strings.Join(DigestFormats, ", "))
+}
+
+// creating func to render a record in one of the DigestFormats, without a trailing newline
+func FormatDigest(rec DigestRecord, format string) (string, error) {
+	raw, err := hex.DecodeString(rec.Digest)
+	if err != nil {
+		return "", fmt.Errorf("digest is not hex: %v", err)
+	}
+	withPath := func(s string) string {
+		if rec.Path == "" {
+			return s
+		}
+		return s + "  " + rec.Path
+	}
+	switch format {
+	case "text":
+		return withPath(rec.Digest), nil
+	case "base64":
+		return withPath(base64.StdEncoding.EncodeToString(raw)), nil
+	case "multihash":
+		mh, err := EncodeMultihash(rec.Algorithm, raw)
+		if err != nil {
+			return "", err
+		}
+		return withPath(mh), nil
+	case "gnu", "bsd":
+		path := rec.Path
+		if path == "" {
+			path = "-"
+		}
+		var b strings.Builder
+		if err := WriteManifest(&b, rec.Algorithm, format, []HashResult{{Path: path, Digest: rec.Digest}}); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(b.String(), "\n"), nil
+	case "json":
+		out, err := json.Marshal(rec)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return "", ValidDigestFormat(format)
+}
+
+// creating func to read a digest written in any of the DigestFormats
+// algo is empty when the format doesn't carry one (text, gnu, base64)
+func ParseDigest(s string) (algo string, digest string, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", "", fmt.Errorf("empty checksum")
+	}
+	// only the first line counts, sidecars hold a single digest
+	if line, _, found := strings.Cut(s, "\n"); found {
+		s = strings.TrimSpace(line)
+	}
+
+	if strings.HasPrefix(s, "{") {
+		var rec DigestRecord
+		if err := json.Unmarshal([]byte(s), &rec); err != nil {
+			return "", "", fmt.Errorf("invalid json checksum: %v", err)
+		}
+		if _, err := hex.DecodeString(rec.Digest); err != nil || rec.Digest == "" {
+			return "", "", fmt.Errorf("invalid digest in json checksum")
+		}
+		return rec.Algorithm, strings.ToLower(rec.Digest), nil
+	}
+
+	// the digest itself never contains spaces, anything after two spaces is a path
+	field, _, _ := strings.Cut(s, "  ")
+	if strings.Contains(s, " (") && strings.Contains(s, ") = ") {
+		entry, err := parseManifestLine(s, "")
+		if err != nil {
+			return "", "", err
+		}
+		return entry.Algo, entry.Digest, nil
+	}
+	field = strings.TrimPrefix(field, "\\")
+
+	// hex digests always have an even length, so an odd-length "f..." is a multibase multihash
+	if len(field)%2 == 1 && strings.HasPrefix(field, "f") {
+		if raw, err := hex.DecodeString(field[1:]); err == nil {
+			a, d, err := DecodeMultihash(raw)
+			if err != nil {
+				return "", "", err
+			}
+			return a, hex.EncodeToString(d), nil
+		}
+	}
+	if _, err := hex.DecodeString(field); err == nil {
+		return "", strings.ToLower(field), nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(field); err == nil {
+		return "", hex.EncodeToString(raw), nil
+	}
+	return "", "", fmt.Errorf("unrecognized checksum format")
+}
+
+// multihash codes (https://github.com/multiformats/multicodec)
+var multihashCodes = map[string]uint64{
+	"md5":         0xd5,
+	"sha224":      0x1013,
+	"sha256":      0x12,
+	"sha384":      0x20,
+	"sha512":      0x13,
+	"sha512-256":  0x1015,
+	"sha3-224":    0x17,
+	"sha3-256":    0x16,
+	"sha3-384":    0x15,
+	"sha3-512":    0x14,
+	"blake2s-256": 0xb260,
+	"blake3":      0x1e,
+}
+
+func multihashCode(algo string, size int) (uint64, bool) {
+	if code, ok := multihashCodes[algo]; ok {
+		return code, true
+	}
+	// blake2b-8 .. blake2b-512 are 0xb201 .. 0xb240, blake2s-8 .. blake2s-256
+	// 0xb241 .. 0xb260, blake3 carries its length separately
+	if strings.HasPrefix(algo, "blake2b-") && size >= 1 && size <= 64 {
+		return 0xb200 + uint64(size), true
+	}
+	if strings.HasPrefix(algo, "blake2s-") && size >= 1 && size <= 32 {
+		return 0xb240 + uint64(size), true
+	}
+	if strings.HasPrefix(algo, "blake3-") {
+		return 0x1e, true
+	}
+	return 0, false
+}
+
+// creating func to encode a digest as a multibase (base16) multihash string
+func EncodeMultihash(algo string, digest []byte) (string, error) {
+	code, ok := multihashCode(algo, len(digest))
+	if !ok {
+		return "", fmt.Errorf("%s has no multihash code", algo)
+	}
+	buf := binary.AppendUvarint(nil, code)
+	buf = binary.AppendUvarint(buf, uint64(len(digest)))
+	buf = append(buf, digest...)
+	return "f" + hex.EncodeToString(buf), nil
+}
+
+// creating func to split a binary multihash into algorithm name and digest
+func DecodeMultihash(mh []byte) (string, []byte, error) {
+	code, n := binary.Uvarint(mh)
+	if n <= 0 {
+		return "", nil, fmt.Errorf("invalid multihash")
+	}
+	length, m := binary.Uvarint(mh[n:])
+	if m <= 0 || uint64(len(mh[n+m:])) != length {
+		return "", nil, fmt.Errorf("invalid multihash length")
+	}
+	digest := mh[n+m:]
+	for algo, c := range multihashCodes {
+		if c != code {
+			continue
+		}
+		if algo == "blake3" && len(digest) != 32 {
+			return fmt.Sprintf("blake3-%d", len(digest)*8), digest, nil
+		}
+		return algo, digest, nil
+	}
+	if code > 0xb200 && code <= 0xb240 {
+		return fmt.Sprintf("blake2b-%d", (code-0xb200)*8), digest, nil
+	}
+	if code > 0xb240 && code < 0xb260 {
+		return fmt.Sprintf("blake2s-%d", (code-0xb240)*8), digest, nil
+	}
+	return "", nil, fmt.Errorf("unknown multihash code 0x%x", code)
+}
@@ -0,0 +1,30 @@
+package utils
+
+// sentinel errors shared by the crypto, plugin and command layers.
+// callers wrap them with details (fmt.Errorf("%w: ...")) and test them with
+// errors.Is, the cmd package maps each one to an exit code
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// the ciphertext or its tag doesn't verify: wrong key or tampered data
+	ErrAuthFailed = errors.New("authentication failed (wrong key or modified data)")
+	// CBC padding is malformed after decryption, which is what a wrong key usually looks like
+	ErrBadPadding = errors.New("invalid padding (wrong key or corrupted data)")
+	// no plugin or key size is registered for the scheme
+	ErrUnsupportedScheme = errors.New("unsupported encryption scheme")
+	// the key doesn't have the size the scheme needs
+	ErrKeyLength = errors.New("invalid key length")
+	// the ciphertext is shorter than its header or not a whole number of blocks
+	ErrTruncated = errors.New("ciphertext is truncated or malformed")
+	// the output file exists and the overwrite policy doesn't allow replacing it
+	ErrExists = errors.New("output file already exists")
+)
+
+// creating func for the error returned for an unknown scheme
+func UnsupportedSchemeError(scheme string) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedScheme, scheme)
+}
@@ -1,32 +1,45 @@
 package utils
 
 import (
+	"fmt"
 	"io"
-	"github.com/schollz/progressbar/v3"
 	"os"
 	"io/ioutil"
+	"time"
 )
 
 func ReadFile(path string) ([]byte, error) {
 	return ioutil.ReadFile(path)
 }
 
+// written atomically (see atomic.go), replacing path if it exists
 func WriteFile(path string, data []byte) error {
-	return ioutil.WriteFile(path, data, 0644)
+	return WriteFileAtomic(path, data, WriteOptions{Perm: CiphertextPerm, Replace: true})
 }
 
-// creating a new file to show progress bar 
-func ReadFileWithProgress(path string) ([]byte, error) {
+// creating func to read a file and report it on the worker's progress line
+// wp may be nil, the caller marks the file done once it is processed
+func ReadFileWithProgress(path string, wp *WorkerProgress) ([]byte, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	info, _ := file.Stat()
-	barProgress := progressbar.DefaultBytes(
-		info.Size(),
-		"reading",
-	)
-	return io.ReadAll(io.TeeReader(file, barProgress))
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	wp.Start(path, info.Size())
+	return io.ReadAll(wp.Reader(file))
+}
+
+// creating func to format a throughput summary for a batch
+func ThroughputSummary(files int, bytes int64, elapsed time.Duration) string {
+	mib := float64(bytes) / (1 << 20)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = mib / elapsed.Seconds()
+	}
+	return fmt.Sprintf("%d file(s), %.1f MiB in %s (%.1f MiB/s)", files, mib, elapsed.Round(time.Millisecond), rate)
 }
\ No newline at end of file
@@ -0,0 +1,156 @@
+package utils
+
+// hash algorithm registry, works like the plugin registry in plugins.go.
+// strings, files and checksum sidecars all hash through here, so a new
+// algorithm only has to be registered once.
+//
+// besides the fixed names, two families take their output length from the name:
+//   blake2b-<bits>  8 to 512 bits, in steps of 8
+//   blake2s-<bits>  8 to 256 bits, in steps of 8 (see blake2s.go)
+//   blake3-<bits>   8 to 2048 bits, in steps of 8
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/sha3"
+	"lukechampine.com/blake3"
+)
+
+// a registered hash algorithm, Size is the digest length in bytes
+type HashAlgorithm struct {
+	Name string
+	Size int
+	New  func() hash.Hash
+}
+
+var hashRegistry = make(map[string]HashAlgorithm)
+
+// creating func to register hash algorithms
+func RegisterHash(name string, size int, fn func() hash.Hash) {
+	hashRegistry[name] = HashAlgorithm{Name: name, Size: size, New: fn}
+}
+
+// creating func to get a hash algorithm, including the variable length families
+func GetHash(name string) (HashAlgorithm, bool) {
+	name = strings.ToLower(name)
+	if h, ok := hashRegistry[name]; ok {
+		return h, true
+	}
+	family, bits, ok := parseHashLength(name)
+	if !ok {
+		return HashAlgorithm{}, false
+	}
+	size := bits / 8
+	switch family {
+	case "blake2b":
+		if size < 1 || size > blake2b.Size {
+			return HashAlgorithm{}, false
+		}
+		return HashAlgorithm{Name: name, Size: size, New: func() hash.Hash {
+			h, _ := blake2b.New(size, nil)
+			return h
+		}}, true
+	case "blake2s":
+		if size < 1 || size > blake2sMaxSize {
+			return HashAlgorithm{}, false
+		}
+		return HashAlgorithm{Name: name, Size: size, New: func() hash.Hash {
+			h, _ := newBlake2s(size, nil)
+			return h
+		}}, true
+	case "blake3":
+		if size < 1 || size > 256 {
+			return HashAlgorithm{}, false
+		}
+		return HashAlgorithm{Name: name, Size: size, New: func() hash.Hash {
+			return blake3.New(size, nil)
+		}}, true
+	}
+	return HashAlgorithm{}, false
+}
+
+// splits names like "blake2b-160" into family and bit length
+func parseHashLength(name string) (string, int, bool) {
+	family, bitStr, found := strings.Cut(name, "-")
+	if !found {
+		return "", 0, false
+	}
+	bits, err := strconv.Atoi(bitStr)
+	if err != nil || bits <= 0 || bits%8 != 0 {
+		return "", 0, false
+	}
+	return family, bits, true
+}
+
+// creating func to list registered hash algorithms
+func ListHashes() []string {
+	names := make([]string, 0, len(hashRegistry))
+	for name := range hashRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// creating func to hash a byte slice with a registered algorithm
+func HashBytes(data []byte, algo string) ([]byte, error) {
+	h, ok := GetHash(algo)
+	if !ok {
+		return nil, unsupportedHashError(algo)
+	}
+	hasher := h.New()
+	hasher.Write(data)
+	return hasher.Sum(nil), nil
+}
+
+// creating func to hash everything read from r with a registered algorithm
+func HashReader(r io.Reader, algo string) ([]byte, error) {
+	sum, _, err := HashReaderN(r, algo)
+	return sum, err
+}
+
+// same as HashReader, also returning the number of bytes hashed
+func HashReaderN(r io.Reader, algo string) ([]byte, int64, error) {
+	h, ok := GetHash(algo)
+	if !ok {
+		return nil, 0, unsupportedHashError(algo)
+	}
+	hasher := h.New()
+	n, err := io.Copy(hasher, r)
+	if err != nil {
+		return nil, n, err
+	}
+	return hasher.Sum(nil), n, nil
+}
+
+func unsupportedHashError(algo string) error {
+	return fmt.Errorf("unsupported algorithm: %s (available: %s, blake2b-<bits>, blake2s-<bits>, blake3-<bits>)", algo, strings.Join(ListHashes(), ", "))
+}
+
+func init() {
+	RegisterHash("md5", md5.Size, md5.New)
+	RegisterHash("sha224", sha256.Size224, sha256.New224)
+	RegisterHash("sha256", sha256.Size, sha256.New)
+	RegisterHash("sha384", sha512.Size384, sha512.New384)
+	RegisterHash("sha512", sha512.Size, sha512.New)
+	RegisterHash("sha512-256", sha512.Size256, sha512.New512_256)
+	RegisterHash("sha3-224", 28, func() hash.Hash { return sha3.New224() })
+	RegisterHash("sha3-256", 32, func() hash.Hash { return sha3.New256() })
+	RegisterHash("sha3-384", 48, func() hash.Hash { return sha3.New384() })
+	RegisterHash("sha3-512", 64, func() hash.Hash { return sha3.New512() })
+	RegisterHash("blake2b-256", blake2b.Size256, func() hash.Hash { h, _ := blake2b.New256(nil); return h })
+	RegisterHash("blake2b-384", blake2b.Size384, func() hash.Hash { h, _ := blake2b.New384(nil); return h })
+	RegisterHash("blake2b-512", blake2b.Size, func() hash.Hash { h, _ := blake2b.New512(nil); return h })
+	RegisterHash("blake2s-256", blake2s.Size, func() hash.Hash { h, _ := blake2s.New256(nil); return h })
+	RegisterHash("blake3", 32, func() hash.Hash { return blake3.New(32, nil) })
+}
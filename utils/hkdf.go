@@ -0,0 +1,89 @@
+package utils
+
+// HKDF (RFC 5869) turns one master key into independent subkeys.
+// every context (file path, tenant, ...) and every purpose (encryption, MAC,
+// naming) gets its own subkey, so leaking one of them says nothing about the others
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// purposes a subkey can be derived for
+const (
+	PurposeEncryption = "enc"
+	PurposeMAC        = "mac"
+	PurposeNaming     = "name"
+	PurposeMerkle     = "merkle" // the leaves of a keyed Merkle manifest
+)
+
+// prefix of every HKDF info string, bump the version if the layout changes
+const subkeyInfoPrefix = "crypto-cli subkey v1"
+
+// subkeys derived from one master key for a single context
+type Subkeys struct {
+	Encryption []byte
+	MAC        []byte
+	Naming     []byte
+}
+
+// creating func to expand input key material into length bytes using HKDF-SHA256
+func HKDF(secret, salt []byte, info string, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), out); err != nil {
+		return nil, fmt.Errorf("hkdf: %w", err)
+	}
+	return out, nil
+}
+
+// creating func to derive one subkey for a purpose and context
+// the info string binds purpose, scheme and context together so two contexts never share a key
+func DeriveSubkey(master []byte, purpose, context, scheme string, length int) ([]byte, error) {
+	info := fmt.Sprintf("%s|%s|%s|%s", subkeyInfoPrefix, purpose, scheme, context)
+	return HKDF(master, nil, info, length)
+}
+
+// creating func to derive the full set of subkeys for a context
+// the encryption subkey is sized for the scheme, MAC and naming subkeys are 32 bytes
+func DeriveSubkeys(master []byte, context, scheme string) (Subkeys, error) {
+	var sk Subkeys
+	length, ok := KeyLen[scheme]
+	if !ok {
+		return sk, UnsupportedSchemeError(scheme)
+	}
+	var err error
+	if sk.Encryption, err = DeriveSubkey(master, PurposeEncryption, context, scheme, length); err != nil {
+		return sk, err
+	}
+	if sk.MAC, err = DeriveSubkey(master, PurposeMAC, context, scheme, 32); err != nil {
+		return sk, err
+	}
+	if sk.Naming, err = DeriveSubkey(master, PurposeNaming, context, scheme, 32); err != nil {
+		return sk, err
+	}
+	return sk, nil
+}
+
+// creating func to pick the key a plugin should actually use
+// plugins that implement SubkeyPlugin get a per-context encryption subkey,
+// everything else gets a copy of the master key. callers must Destroy the result
+func KeyForPlugin(plugin Plugin, master []byte, context string) (*SecretBuffer, error) {
+	sp, ok := plugin.(SubkeyPlugin)
+	if !ok || !sp.UsesSubkeys() || context == "" {
+		key := NewSecretBuffer(len(master))
+		copy(key.Bytes(), master)
+		return key, nil
+	}
+	length, ok := KeyLen[plugin.Name()]
+	if !ok {
+		return nil, UnsupportedSchemeError(plugin.Name())
+	}
+	subkey, err := DeriveSubkey(master, PurposeEncryption, context, plugin.Name(), length)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretBufferFrom(subkey), nil
+}
@@ -0,0 +1,84 @@
+package utils
+
+// password based key derivation functions, shared by the encryption key
+// derivation (DeriveKeyWithScheme) and the stored password hashes (phc.go)
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Argon2id cost parameters, Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+}
+
+// scrypt cost parameters, N = 2^LogN
+type ScryptParams struct {
+	LogN uint8
+	R    int
+	P    int
+}
+
+// defaults for new password hashes (RFC 9106 second recommendation for Argon2id,
+// OWASP minimums for the others)
+var (
+	DefaultArgon2Params  = Argon2Params{Memory: 64 * 1024, Time: 3, Parallelism: 4}
+	DefaultScryptParams  = ScryptParams{LogN: 17, R: 8, P: 1}
+	DefaultPBKDF2Rounds  = 600000
+	maxPBKDF2Rounds      = 10_000_000 // a few seconds of CPU, a stored hash can't ask for more
+	DefaultBcryptCost    = 12
+	maxArgon2Memory      = uint32(4 * 1024 * 1024) // 4 GiB
+	maxScryptMemoryBytes = int64(4 << 30)
+)
+
+// creating func for PBKDF2-HMAC-SHA256
+func DerivePBKDF2(password, salt []byte, iterations, length int) ([]byte, error) {
+	if iterations < 1 || iterations > maxPBKDF2Rounds {
+		return nil, fmt.Errorf("pbkdf2 iterations must be between 1 and %d", maxPBKDF2Rounds)
+	}
+	return pbkdf2.Key(password, salt, iterations, length, sha256.New), nil
+}
+
+// creating func for Argon2id
+func DeriveArgon2id(password, salt []byte, p Argon2Params, length int) ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return argon2.IDKey(password, salt, p.Time, p.Memory, p.Parallelism, uint32(length)), nil
+}
+
+// creating func for scrypt
+func DeriveScrypt(password, salt []byte, p ScryptParams, length int) ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return scrypt.Key(password, salt, 1<<p.LogN, p.R, p.P, length)
+}
+
+// parameters usually come from a stored hash, so they are bounded before any memory is allocated
+func (p Argon2Params) validate() error {
+	if p.Time < 1 || p.Parallelism < 1 {
+		return fmt.Errorf("argon2id time and parallelism must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Parallelism) || p.Memory > maxArgon2Memory {
+		return fmt.Errorf("argon2id memory must be between %d and %d KiB", 8*uint32(p.Parallelism), maxArgon2Memory)
+	}
+	return nil
+}
+
+func (p ScryptParams) validate() error {
+	if p.LogN < 1 || p.LogN > 30 || p.R < 1 || p.P < 1 {
+		return fmt.Errorf("invalid scrypt parameters ln=%d r=%d p=%d", p.LogN, p.R, p.P)
+	}
+	if 128*int64(p.R)*(int64(1)<<p.LogN) > maxScryptMemoryBytes {
+		return fmt.Errorf("scrypt parameters ln=%d r=%d need more than 4 GiB of memory", p.LogN, p.R)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+// keyfiles hold raw, high-entropy key material instead of a typed key or password.
+// a keyfile can be used on its own, or mixed with a password so that both
+// are needed to rebuild the key (two-factor mode)
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+)
+
+// info string for the password+keyfile HKDF step, bump the version if the construction changes
+const keyfileInfo = "crypto-cli password+keyfile v1 "
+
+// creating func to read a keyfile and check it is the right size for the scheme
+func ReadKeyFile(path string, scheme string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if err := ValidateKeyLength(key, scheme); err != nil {
+		return nil, fmt.Errorf("keyfile %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// creating func to generate random key material of the given size from the CSPRNG
+func GenerateKey(length int) ([]byte, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrKeyLength, length)
+	}
+	key := make([]byte, length)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// creating func to write a keyfile readable only by the owner
+// an existing file is never overwritten so a key can't be lost by accident
+func WriteKeyFile(path string, key []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create keyfile: %w", err)
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// creating func to derive a key from both a password and a keyfile
+// the password goes through PBKDF2 as usual, then the result and the keyfile
+// are mixed with HKDF so neither one alone is enough to rebuild the key
+func DeriveKeyWithKeyfile(password []byte, keyfile []byte, salt []byte, scheme string) (*SecretBuffer, error) {
+	passKey, err := DeriveKeyWithScheme(password, salt, scheme)
+	if err != nil {
+		return nil, err
+	}
+	defer passKey.Destroy()
+
+	ikm := NewSecretBuffer(passKey.Len() + len(keyfile))
+	defer ikm.Destroy()
+	copy(ikm.Bytes(), passKey.Bytes())
+	copy(ikm.Bytes()[passKey.Len():], keyfile)
+
+	key, err := HKDF(ikm.Bytes(), salt, keyfileInfo+scheme, passKey.Len())
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretBufferFrom(key), nil
+}
@@ -0,0 +1,130 @@
+package utils
+
+// a keystore is a YAML file mapping key IDs to generated keys, so commands can
+// refer to a key with --key-id instead of passing it around on the command line.
+// the file is only protected by its 0600 permissions, keep it somewhere safe
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type KeystoreEntry struct {
+	Scheme      string    `yaml:"scheme"`
+	Key         string    `yaml:"key"`
+	Fingerprint string    `yaml:"fingerprint"`
+	Created     time.Time `yaml:"created"`
+}
+
+type Keystore struct {
+	Keys map[string]KeystoreEntry `yaml:"keys"`
+}
+
+// creating func to compute a short fingerprint of a key for out-of-band checks
+// this is the first 8 bytes of SHA-256(key), grouped for reading aloud
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	h := hex.EncodeToString(sum[:8])
+	groups := make([]string, 0, len(h)/4)
+	for i := 0; i < len(h); i += 4 {
+		groups = append(groups, h[i:i+4])
+	}
+	return strings.Join(groups, ":")
+}
+
+// creating func to load a keystore, a missing file gives an empty keystore
+func LoadKeystore(path string) (*Keystore, error) {
+	ks := &Keystore{Keys: map[string]KeystoreEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+	if err := yaml.Unmarshal(data, ks); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore: %w", err)
+	}
+	if ks.Keys == nil {
+		ks.Keys = map[string]KeystoreEntry{}
+	}
+	return ks, nil
+}
+
+// creating func to write the keystore back with owner-only permissions
+// the new content goes to a temp file first so a crash never leaves a half-written keystore
+func SaveKeystore(path string, ks *Keystore) error {
+	data, err := yaml.Marshal(ks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal keystore: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// creating func to add a key under a new ID, existing IDs are never replaced
+func (ks *Keystore) Add(id, scheme string, key []byte) error {
+	if id == "" {
+		return fmt.Errorf("key ID must not be empty")
+	}
+	if _, exists := ks.Keys[id]; exists {
+		return fmt.Errorf("key ID %q already exists in keystore", id)
+	}
+	ks.Keys[id] = KeystoreEntry{
+		Scheme:      scheme,
+		Key:         base64.StdEncoding.EncodeToString(key),
+		Fingerprint: KeyFingerprint(key),
+		Created:     time.Now().UTC(),
+	}
+	return nil
+}
+
+// creating func to look up a key by ID, the key is returned in a SecretBuffer
+func (ks *Keystore) Get(id string) (*SecretBuffer, KeystoreEntry, error) {
+	entry, ok := ks.Keys[id]
+	if !ok {
+		return nil, entry, fmt.Errorf("key ID %q not found in keystore", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(entry.Key)
+	if err != nil {
+		return nil, entry, fmt.Errorf("key ID %q is corrupt: %w", id, err)
+	}
+	return NewSecretBufferFrom(key), entry, nil
+}
+
+// creating func to load a single key from a keystore file
+func LoadKeystoreKey(path, id string) (*SecretBuffer, KeystoreEntry, error) {
+	ks, err := LoadKeystore(path)
+	if err != nil {
+		return nil, KeystoreEntry{}, err
+	}
+	return ks.Get(id)
+}
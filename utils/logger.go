@@ -1,103 +1,398 @@
 package utils
 
-// time to implement logging/verbose to my code
+// logging on top of log/slog.
+// the console gets one of three formats (colored text, json or logfmt) and the
+// optional log file gets the same format without colors, rotated by size.
+// Debug/Info/Warn/Error keep their printf style, structured fields go through
+// Log().With(...) using the Field* keys so every sink names them the same way
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
 )
 
+// LoggerOptions configures InitLoggerWithOptions
+type LoggerOptions struct {
+	Level      string // debug, info, warn, error
+	Format     string // text, json or logfmt
+	Path       string // log file, empty for console only
+	MaxSize    int64  // rotate the log file when it would grow past this many bytes, 0 never rotates
+	MaxBackups int    // rotated files to keep (path.1 ... path.N)
+}
+
+// keys for structured fields
+const (
+	FieldFile     = "file"
+	FieldScheme   = "scheme"
+	FieldBytes    = "bytes"
+	FieldDuration = "duration"
+	FieldWorker   = "worker"
+)
+
+var LogFormats = []string{"text", "json", "logfmt"}
+
+const DefaultLogPath = "crypto-cli.log"
+
 var (
-	logger    *log.Logger
-	logToFile bool
-	logFile   *os.File
-	logWriter io.Writer
-	LogLevel	string
-	isTerminal	bool
+	logger     = slog.New(newConsoleHandler(progressConsole{os.Stderr}, "text", logLevel))
+	logLevel   = &slog.LevelVar{}
+	logFile    *rotatingFile
+	LogLevel   string
+	isTerminal bool
 )
 
 // ANSI color code
 var (
-	Reset	= 	"\033[0m"
-	Red	= 	"\033[31m"
-	Yellow	= 	"\033[33m"
-	Cyan	= 	"\033[36m"
-	Green	= 	"\033[32m"
-	Gray	= 	"\033[90m"
+	Reset  = "\033[0m"
+	Red    = "\033[31m"
+	Yellow = "\033[33m"
+	Cyan   = "\033[36m"
+	Green  = "\033[32m"
+	Gray   = "\033[90m"
 )
 
 // First step: initializing the logger
+// kept for callers that only pick a level and whether to log to crypto-cli.log
 func InitLogger(level string, enableFile bool) {
-	LogLevel = level
-	logToFile = enableFile
-	isTerminal = true
-
-
-	// writing to log
-	logWriter = os.Stdout
-	// error handling
-	if logToFile {
-		var err error
-		logFile, err := os.OpenFile("crypto-cli.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			fmt.Println("[ERROR] Failed to create log file:", err)
-			return
-		} else {
-			logWriter = io.MultiWriter(os.Stdout, logFile) // includes timestamps
+	opts := LoggerOptions{Level: level, Format: "text"}
+	if enableFile {
+		opts.Path = DefaultLogPath
+	}
+	if err := InitLoggerWithOptions(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "[ERROR] Failed to set up logging:", err)
+	}
+}
+
+// creating func to build the logger from options
+// on error the console logger is still set up, only the file sink is missing
+func InitLoggerWithOptions(opts LoggerOptions) error {
+	level, err := parseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	LogLevel = strings.ToLower(opts.Level)
+	logLevel.Set(level)
+	if opts.Format == "" {
+		opts.Format = "text"
+	}
+	if err := validLogFormat(opts.Format); err != nil {
+		return err
+	}
+
+	// logs never mix with results on stdout
+	console := os.Stderr
+	isTerminal = term.IsTerminal(int(console.Fd())) && os.Getenv("NO_COLOR") == ""
+	handlers := []slog.Handler{newConsoleHandler(progressConsole{console}, opts.Format, logLevel)}
+
+	Cleanup()
+	var fileErr error
+	if opts.Path != "" {
+		logFile, fileErr = openRotatingFile(opts.Path, opts.MaxSize, opts.MaxBackups)
+		if fileErr == nil {
+			handlers = append(handlers, newFileHandler(logFile, opts.Format, logLevel))
 		}
-		// logger.SetOutput(logFile)
 	}
-	// creating new log output
-	logger = log.New(logWriter, "", log.LstdFlags)
+	if len(handlers) == 1 {
+		logger = slog.New(handlers[0])
+	} else {
+		logger = slog.New(multiHandler(handlers))
+	}
+	return fileErr
 }
 
-func shouldLog(req string) bool {
-	order := map[string]int{"debug": 1, "info": 2, "warn": 3, "error": 4}
-	return order[req] >= order[LogLevel]
+// creating func to get the logger for structured logging
+func Log() *slog.Logger {
+	return logger
 }
 
-// Function to create debug to debug logs
-func Debug(msg string, args ...any) {
-	if shouldLog("debug") {
-		logWithColor("[DEBUG] ", Gray, msg, args...)
+func parseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
 	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level: %s (choose debug, info, warn or error)", s)
 }
 
+func validLogFormat(format string) error {
+	for _, f := range LogFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log format: %s (choose %s)", format, strings.Join(LogFormats, ", "))
+}
 
-// Function to create info to print regular logs
-func Info(msg string, args ...any) {
-	if shouldLog("info") {
-		logWithColor("[INFO] ", Cyan, msg, args...)
+func newConsoleHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	switch format {
+	case "json":
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	case "logfmt":
+		return slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
 	}
+	return &textHandler{w: w, level: level, color: isTerminal, mu: &sync.Mutex{}}
 }
 
-// Function to create info to print regular logs
-func Warn(msg string, args ...any) {
-	if shouldLog("warn") {
-		logWithColor("[WARN] ", Yellow, msg, args...)
+// the file never gets colors
+func newFileHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	if format == "text" {
+		return &textHandler{w: w, level: level, mu: &sync.Mutex{}}
 	}
+	return newConsoleHandler(w, format, level)
 }
 
+// Function to create debug to debug logs
+func Debug(msg string, args ...any) {
+	logf(slog.LevelDebug, msg, args...)
+}
 
+// Function to create info to print regular logs
+func Info(msg string, args ...any) {
+	logf(slog.LevelInfo, msg, args...)
+}
+
+// Function to create info to print regular logs
+func Warn(msg string, args ...any) {
+	logf(slog.LevelWarn, msg, args...)
+}
 
 // Function to create error to print error logs
 func Error(msg string, args ...any) {
-	if shouldLog("Error"){
-		logWithColor("[ERROR] ", Red, msg, args...)
-	}
+	logf(slog.LevelError, msg, args...)
 }
-func logWithColor(prefix, color, msg string, args ...any) {
-	colorPrefix := prefix
-	if isTerminal {
-		colorPrefix = fmt.Sprintf("%s%s%s", color, prefix, Reset)
+
+func logf(level slog.Level, msg string, args ...any) {
+	if !logger.Enabled(context.Background(), level) {
+		return
 	}
-	logger.Printf("%s %s", colorPrefix, fmt.Sprintf(msg, args...))
+	logger.Log(context.Background(), level, fmt.Sprintf(msg, args...))
 }
+
 // Function to cleanup log file if opened
 func Cleanup() {
 	if logFile != nil {
 		logFile.Close()
+		logFile = nil
+	}
+}
+
+// textHandler keeps the old console look:
+// 2006/01/02 15:04:05 [INFO]  message key=value
+type textHandler struct {
+	w      io.Writer
+	level  slog.Leveler
+	color  bool
+	pre    string // attrs from WithAttrs, already formatted with their groups
+	groups []string
+	mu     *sync.Mutex
+}
+
+func (h *textHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	prefix, color := "[INFO] ", Cyan
+	switch {
+	case r.Level >= slog.LevelError:
+		prefix, color = "[ERROR] ", Red
+	case r.Level >= slog.LevelWarn:
+		prefix, color = "[WARN] ", Yellow
+	case r.Level < slog.LevelInfo:
+		prefix, color = "[DEBUG] ", Gray
+	}
+	if h.color {
+		prefix = color + prefix + Reset
+	}
+
+	var b strings.Builder
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	b.WriteString(prefix)
+	b.WriteString(" ")
+	b.WriteString(r.Message)
+	b.WriteString(h.pre)
+	r.Attrs(func(a slog.Attr) bool {
+		writeTextAttr(&b, h.groups, a)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func writeTextAttr(b *strings.Builder, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeTextAttr(b, append(groups, a.Key), ga)
+		}
+		return
+	}
+	key := a.Key
+	if len(groups) > 0 {
+		key = strings.Join(groups, ".") + "." + key
+	}
+	val := a.Value.String()
+	if a.Value.Kind() == slog.KindDuration {
+		val = a.Value.Duration().Round(time.Microsecond).String()
+	}
+	if strings.ContainsAny(val, " \"=") {
+		val = fmt.Sprintf("%q", val)
+	}
+	fmt.Fprintf(b, " %s=%s", key, val)
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		writeTextAttr(&b, h.groups, a)
+	}
+	h2 := *h
+	h2.pre += b.String()
+	return &h2
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.groups = append(append([]string{}, h.groups...), name)
+	return &h2
+}
+
+// multiHandler fans every record out to several handlers (console and file)
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(multiHandler, len(m))
+	for i, h := range m {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	out := make(multiHandler, len(m))
+	for i, h := range m {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// rotatingFile is an append-only log file that is rotated by size:
+// path -> path.1 -> path.2 ... keeping at most backups old files
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	f       *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size = f, info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	rf.f = nil
+	if rf.backups < 1 {
+		os.Remove(rf.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.backups))
+		for i := rf.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			return err
+		}
+	}
+	return rf.open()
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return nil
 	}
+	err := rf.f.Close()
+	rf.f = nil
+	return err
 }
@@ -0,0 +1,75 @@
+package utils
+
+// keyed hashing for message authentication:
+// HMAC works with every algorithm in the hash registry, and BLAKE2b, BLAKE2s
+// and BLAKE3 can also be used in their own keyed mode, which needs no HMAC wrapper
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+	"lukechampine.com/blake3"
+)
+
+// creating func to build a MAC for a registered algorithm
+// native selects the algorithm's own keyed mode instead of HMAC
+func NewMAC(algo string, key []byte, native bool) (hash.Hash, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("a key is required for keyed hashing")
+	}
+	if native {
+		return newNativeMAC(strings.ToLower(algo), key)
+	}
+	h, ok := GetHash(algo)
+	if !ok {
+		return nil, unsupportedHashError(algo)
+	}
+	return hmac.New(h.New, key), nil
+}
+
+func newNativeMAC(algo string, key []byte) (hash.Hash, error) {
+	switch {
+	case algo == "blake2s-256":
+		return blake2s.New256(key)
+	case strings.HasPrefix(algo, "blake2s-"):
+		h, ok := GetHash(algo)
+		if !ok {
+			return nil, unsupportedHashError(algo)
+		}
+		return newBlake2s(h.Size, key)
+	case strings.HasPrefix(algo, "blake2b-"):
+		h, ok := GetHash(algo)
+		if !ok {
+			return nil, unsupportedHashError(algo)
+		}
+		return blake2b.New(h.Size, key)
+	case algo == "blake3" || strings.HasPrefix(algo, "blake3-"):
+		h, ok := GetHash(algo)
+		if !ok {
+			return nil, unsupportedHashError(algo)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("keyed BLAKE3 needs a 32-byte key, got %d bytes", len(key))
+		}
+		return blake3.New(h.Size, key), nil
+	}
+	return nil, fmt.Errorf("algorithm %s has no native keyed mode, use HMAC instead", algo)
+}
+
+// creating func to compare an expected hex MAC with a computed one in constant time
+func VerifyMAC(expectedHex, gotHex string) bool {
+	expected, err := hex.DecodeString(strings.TrimSpace(expectedHex))
+	if err != nil {
+		return false
+	}
+	got, err := hex.DecodeString(gotHex)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, got)
+}
@@ -0,0 +1,359 @@
+package utils
+
+// checksum manifests compatible with GNU coreutils (sha256sum, b2sum, ...)
+// and with the BSD tag format, so the files can also be checked with those tools.
+//
+//   gnu:  <hex digest>  <path>
+//   bsd:  SHA256 (<path>) = <hex digest>
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// result of hashing one file
+type HashResult struct {
+	Path     string
+	Digest   string
+	Size     int64
+	Duration time.Duration
+	Err      error
+}
+
+// one line of a manifest
+type ManifestEntry struct {
+	Algo   string
+	Path   string
+	Digest string
+}
+
+// creating func to expand the given paths into a list of regular files
+// glob patterns are expanded (for shells that don't) and directories are walked
+// recursively, each in sorted order, so the same arguments always give the same list
+func CollectFiles(paths []string) ([]string, error) {
+	var expanded []string
+	for _, p := range paths {
+		if !strings.ContainsAny(p, "*?[") {
+			expanded = append(expanded, p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", p)
+		}
+		expanded = append(expanded, matches...)
+	}
+
+	var files []string
+	for _, p := range expanded {
+		// paths that can't be stat'ed stay in the list so hashing reports them per file
+		info, err := os.Stat(p)
+		if err != nil || !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		var found []string
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// status of one manifest entry after checking
+const (
+	CheckOK      = "OK"
+	CheckFailed  = "FAILED"
+	CheckMissing = "MISSING"
+)
+
+type CheckResult struct {
+	Entry  ManifestEntry
+	Status string
+	Err    error
+}
+
+// creating func to hash many files on a bounded pool of workers
+// results come back in the same order as paths. every file is shown on
+// its worker's line of progress (which may be nil)
+func HashFiles(paths []string, algo string, workers int, progress *Progress) []HashResult {
+	results := make([]HashResult, len(paths))
+	ParallelForWorkers(len(paths), workers, func(worker, i int) {
+		results[i] = hashOneFile(paths[i], algo, progress.Worker(worker))
+	})
+	return results
+}
+
+// creating func to check every manifest entry against the file on disk
+// results come back in manifest order
+func CheckManifest(entries []ManifestEntry, workers int, progress *Progress) []CheckResult {
+	results := make([]CheckResult, len(entries))
+	ParallelForWorkers(len(entries), workers, func(worker, i int) {
+		e := entries[i]
+		res := CheckResult{Entry: e, Status: CheckOK}
+		h := hashOneFile(e.Path, e.Algo, progress.Worker(worker))
+		switch {
+		case errors.Is(h.Err, fs.ErrNotExist):
+			res.Status = CheckMissing
+		case h.Err != nil:
+			res.Status = CheckFailed
+			res.Err = h.Err
+		case h.Digest != e.Digest:
+			res.Status = CheckFailed
+		}
+		results[i] = res
+	})
+	return results
+}
+
+// creating func to run fn(0..n-1) on at most workers goroutines
+func ParallelFor(n, workers int, fn func(i int)) {
+	ParallelForWorkers(n, workers, func(_, i int) { fn(i) })
+}
+
+// same as ParallelFor, fn also gets the number of the worker running it (0..workers-1)
+func ParallelForWorkers(n, workers int, fn func(worker, i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := range jobs {
+				fn(worker, i)
+			}
+		}(w)
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func hashOneFile(path, algo string, wp *WorkerProgress) (res HashResult) {
+	res = HashResult{Path: path}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+	defer wp.Done()
+	f, err := os.Open(path)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		res.Size = info.Size()
+	}
+	wp.Start(path, res.Size)
+	sum, n, err := HashReaderN(wp.Reader(f), algo)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Digest = hex.EncodeToString(sum)
+	res.Size = n
+	return res
+}
+
+// creating func to write a manifest in gnu or bsd format
+func WriteManifest(w io.Writer, algo, format string, results []HashResult) error {
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		var line string
+		switch format {
+		case "gnu":
+			// coreutils marks lines with escaped names with a leading backslash
+			name, escaped := escapeManifestPath(r.Path)
+			prefix := ""
+			if escaped {
+				prefix = "\\"
+			}
+			line = fmt.Sprintf("%s%s  %s\n", prefix, r.Digest, name)
+		case "bsd":
+			line = fmt.Sprintf("%s (%s) = %s\n", bsdTag(algo), r.Path, r.Digest)
+		default:
+			return fmt.Errorf("unsupported manifest format: %s (choose gnu or bsd)", format)
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// creating func to parse a manifest in either format
+// gnu lines carry no algorithm, so they get defaultAlgo; with an empty defaultAlgo
+// it is inferred from the digest length like the sha*sum tools would have written it
+func ParseManifest(r io.Reader, defaultAlgo string) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseManifestLine(line, defaultAlgo)
+		if err != nil {
+			return nil, fmt.Errorf("manifest line %d: %w", lineNo, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func parseManifestLine(line, defaultAlgo string) (ManifestEntry, error) {
+	// bsd: TAG (path) = digest
+	if open := strings.Index(line, " ("); open > 0 && !strings.Contains(line[:open], " ") {
+		if close := strings.LastIndex(line, ") = "); close > open {
+			tag := line[:open]
+			algo, ok := algoFromBSDTag(tag)
+			if !ok {
+				return ManifestEntry{}, fmt.Errorf("unknown algorithm tag %q", tag)
+			}
+			digest := line[close+4:]
+			if err := checkDigestLen(digest, algo); err != nil {
+				return ManifestEntry{}, err
+			}
+			return ManifestEntry{Algo: algo, Path: line[open+2 : close], Digest: strings.ToLower(digest)}, nil
+		}
+	}
+
+	// gnu: digest, two spaces (or space + '*' for binary mode), path
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+	digest, rest, found := strings.Cut(line, " ")
+	if !found || len(rest) < 2 || (rest[0] != ' ' && rest[0] != '*') {
+		return ManifestEntry{}, fmt.Errorf("malformed line")
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return ManifestEntry{}, fmt.Errorf("malformed digest")
+	}
+	algo := defaultAlgo
+	if algo == "" {
+		var ok bool
+		if algo, ok = algoFromDigestLen(len(digest)); !ok {
+			return ManifestEntry{}, fmt.Errorf("malformed line: no supported algorithm has %d hex digit digests, pass --algo", len(digest))
+		}
+	}
+	if err := checkDigestLen(digest, algo); err != nil {
+		return ManifestEntry{}, err
+	}
+	path := rest[1:]
+	if escaped {
+		path = unescapeManifestPath(path)
+	}
+	return ManifestEntry{Algo: algo, Path: path, Digest: strings.ToLower(digest)}, nil
+}
+
+// algorithm of an untagged line by its digest length, the sha2 family that
+// md5sum and sha*sum write (sha3 and blake2 of the same length need --algo)
+func algoFromDigestLen(n int) (string, bool) {
+	algo, ok := map[int]string{32: "md5", 56: "sha224", 64: "sha256", 96: "sha384", 128: "sha512"}[n]
+	if !ok {
+		return "", false
+	}
+	_, ok = GetHash(algo)
+	return algo, ok
+}
+
+// a digest of the wrong length can never match, the line is malformed rather than FAILED
+func checkDigestLen(digest, algo string) error {
+	h, ok := GetHash(algo)
+	if !ok {
+		return fmt.Errorf("unsupported algorithm: %s", algo)
+	}
+	if len(digest) != 2*h.Size {
+		return fmt.Errorf("malformed line: %d hex digit digest, %s has %d", len(digest), algo, 2*h.Size)
+	}
+	return nil
+}
+
+// tag used by coreutils --tag output for an algorithm
+func bsdTag(algo string) string {
+	switch algo {
+	case "blake2b-512":
+		return "BLAKE2b"
+	case "sha512-256":
+		return "SHA512/256"
+	}
+	if strings.HasPrefix(algo, "blake2b-") {
+		return "BLAKE2b-" + strings.TrimPrefix(algo, "blake2b-")
+	}
+	if strings.HasPrefix(algo, "blake2s-") {
+		return "BLAKE2s-" + strings.TrimPrefix(algo, "blake2s-")
+	}
+	return strings.ToUpper(algo)
+}
+
+func algoFromBSDTag(tag string) (string, bool) {
+	algo := strings.ToLower(tag)
+	switch algo {
+	case "blake2b":
+		algo = "blake2b-512"
+	case "sha512/256", "sha512t256":
+		// coreutils, and FreeBSD's sha512t256
+		algo = "sha512-256"
+	}
+	if _, ok := GetHash(algo); !ok {
+		return "", false
+	}
+	return algo, true
+}
+
+func escapeManifestPath(path string) (string, bool) {
+	if !strings.ContainsAny(path, "\\\n\r") {
+		return path, false
+	}
+	r := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	return r.Replace(path), true
+}
+
+func unescapeManifestPath(path string) string {
+	r := strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r")
+	return r.Replace(path)
+}
+
+// creating func to add up the sizes of files, used to size progress bars
+func TotalSize(paths []string) int64 {
+	var total int64
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseManifestDigestLength(t *testing.T) {
+	sha512 := strings.Repeat("ab", 64)
+	sha256 := strings.Repeat("cd", 32)
+	md5 := strings.Repeat("ef", 16)
+
+	// without an algorithm the gnu lines of sha512sum, sha256sum and md5sum are told apart by length
+	entries, err := ParseManifest(strings.NewReader(sha512+"  a.txt\n"+sha256+" *b.txt\n"+md5+"  c.txt\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"sha512", "sha256", "md5"} {
+		if entries[i].Algo != want {
+			t.Errorf("line %d: algo %s, want %s", i+1, entries[i].Algo, want)
+		}
+	}
+
+	bad := []struct {
+		name, line, algo string
+	}{
+		{"sha512 digest with --algo sha256", sha512 + "  a.txt", "sha256"},
+		{"sha1 digest, not supported", strings.Repeat("01", 20) + "  a.txt", ""},
+		{"bsd tag with a short digest", "SHA256 (a.txt) = " + md5, ""},
+	}
+	for _, tt := range bad {
+		if _, err := ParseManifest(strings.NewReader(tt.line+"\n"), tt.algo); err == nil || !strings.Contains(err.Error(), "malformed line") {
+			t.Errorf("%s: got %v, want a malformed line error", tt.name, err)
+		}
+	}
+}
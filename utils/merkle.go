@@ -0,0 +1,362 @@
+package utils
+
+// chunked Merkle tree manifests for partial integrity verification.
+// the file is split into fixed-size chunks, each chunk is a leaf and the
+// leaves are hashed pairwise up to a single root:
+//
+//   leaf = H(0x00 || chunk)
+//   node = H(0x01 || left || right)   (an odd node at the end moves up unchanged)
+//
+// the root goes into the .meta.yaml metadata and the leaves into a
+// .merkle.yaml sidecar, so a corrupted file can be narrowed down to the
+// exact chunks that changed, and a byte range can be checked without
+// reading the rest of the file.
+//
+// a keyed tree uses HMAC(key, 0x00 || chunk) for the leaves instead. Its
+// manifest can sit next to the ciphertext: without the key the leaves say
+// nothing about the plaintext, where plain hashes would let anyone confirm a
+// guessed chunk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultMerkleChunkSize = 1 << 20
+
+// every chunk is held in memory while it is hashed, so the size is bounded
+// (also when it comes from a manifest)
+const MaxMerkleChunkSize = 64 << 20
+
+var ErrMerkleKeyRequired = errors.New("the merkle manifest is keyed, the key it was written with is needed to verify it")
+
+type MerkleTree struct {
+	Algo      string   `yaml:"algo"`
+	Keyed     bool     `yaml:"keyed,omitempty"`
+	ChunkSize int64    `yaml:"chunk_size"`
+	Size      int64    `yaml:"size"`
+	Root      string   `yaml:"root"`
+	Leaves    []string `yaml:"leaves"`
+
+	key []byte // HMAC key of the leaves of a keyed tree, see SetKey
+}
+
+// creating func to check a chunk size before anything is allocated for it
+func ValidMerkleChunkSize(n int64) error {
+	if n <= 0 || n > MaxMerkleChunkSize {
+		return fmt.Errorf("chunk size must be between 1 and %d bytes", int64(MaxMerkleChunkSize))
+	}
+	return nil
+}
+
+// a half-open byte range [Start, End)
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+func (r ByteRange) String() string {
+	return fmt.Sprintf("bytes %d-%d", r.Start, r.End-1)
+}
+
+// creating func to build a Merkle tree over everything read from r
+// the tree is keyed when key is not empty
+func BuildMerkleTree(r io.Reader, chunkSize int64, algo string, key []byte) (*MerkleTree, error) {
+	if err := ValidMerkleChunkSize(chunkSize); err != nil {
+		return nil, err
+	}
+	if _, ok := GetHash(algo); !ok {
+		return nil, unsupportedHashError(algo)
+	}
+	tree := &MerkleTree{Algo: algo, ChunkSize: chunkSize, Keyed: len(key) > 0, key: key}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 || (tree.Size == 0 && len(tree.Leaves) == 0 && err == io.EOF) {
+			leaf, herr := tree.leaf(buf[:n])
+			if herr != nil {
+				return nil, herr
+			}
+			tree.Leaves = append(tree.Leaves, hex.EncodeToString(leaf))
+			tree.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	root, err := tree.computeRoot()
+	if err != nil {
+		return nil, err
+	}
+	tree.Root = hex.EncodeToString(root)
+	return tree, nil
+}
+
+// creating func to give a keyed tree (loaded from its manifest) the key of its leaves
+func (t *MerkleTree) SetKey(key []byte) {
+	t.key = key
+}
+
+func (t *MerkleTree) leaf(chunk []byte) ([]byte, error) {
+	if !t.Keyed {
+		return HashBytes(append([]byte{0x00}, chunk...), t.Algo)
+	}
+	if len(t.key) == 0 {
+		return nil, ErrMerkleKeyRequired
+	}
+	mac, err := NewMAC(t.Algo, t.key, false)
+	if err != nil {
+		return nil, err
+	}
+	mac.Write([]byte{0x00})
+	mac.Write(chunk)
+	return mac.Sum(nil), nil
+}
+
+func merkleNode(left, right []byte, algo string) ([]byte, error) {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, 0x01)
+	data = append(data, left...)
+	data = append(data, right...)
+	return HashBytes(data, algo)
+}
+
+// recomputing the root from the stored leaves
+func (t *MerkleTree) computeRoot() ([]byte, error) {
+	if len(t.Leaves) == 0 {
+		return nil, fmt.Errorf("merkle tree has no leaves")
+	}
+	level := make([][]byte, len(t.Leaves))
+	for i, l := range t.Leaves {
+		b, err := hex.DecodeString(l)
+		if err != nil {
+			return nil, fmt.Errorf("leaf %d is not valid hex", i)
+		}
+		level[i] = b
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			node, err := merkleNode(level[i], level[i+1], t.Algo)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, node)
+		}
+		level = next
+	}
+	return level[0], nil
+}
+
+// creating func to check the stored leaves really produce the stored root
+// (and expectedRoot, usually taken from the metadata, when it is not empty)
+func (t *MerkleTree) CheckRoot(expectedRoot string) error {
+	root, err := t.computeRoot()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(root) != t.Root {
+		return errors.New("merkle leaves do not match the stored root")
+	}
+	if expectedRoot != "" && expectedRoot != t.Root {
+		return errors.New("merkle root does not match the root in the metadata")
+	}
+	return nil
+}
+
+// creating func to verify a whole file, returning the corrupted byte ranges
+func (t *MerkleTree) Verify(r io.ReaderAt, size int64) ([]ByteRange, error) {
+	end := size
+	if t.Size > end {
+		end = t.Size
+	}
+	return t.VerifyRange(r, size, 0, end)
+}
+
+// creating func to verify only the chunks overlapping [start, end)
+// only those chunks are read, the rest of the file is never touched
+func (t *MerkleTree) VerifyRange(r io.ReaderAt, size, start, end int64) ([]ByteRange, error) {
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid range %d-%d", start, end)
+	}
+	var bad []ByteRange
+	// a size change is corruption of its own, covering the differing tail
+	if size != t.Size {
+		lo, hi := size, t.Size
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if lo < end && hi > start {
+			bad = appendRange(bad, ByteRange{max(lo, start), min(hi, end)})
+		}
+	}
+
+	first := start / t.ChunkSize
+	last := (end - 1) / t.ChunkSize
+	if end == start {
+		last = first - 1
+	}
+	buf := make([]byte, t.ChunkSize)
+	for i := first; i <= last && i < int64(len(t.Leaves)); i++ {
+		n, err := r.ReadAt(buf, i*t.ChunkSize)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if bad, err = t.checkChunk(bad, i, buf[:n]); err != nil {
+			return nil, err
+		}
+	}
+	return mergeRanges(bad), nil
+}
+
+// checks chunk i against its leaf, adding its range to bad when it differs
+func (t *MerkleTree) checkChunk(bad []ByteRange, i int64, chunk []byte) ([]ByteRange, error) {
+	leaf, err := t.leaf(chunk)
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(leaf) == t.Leaves[i] {
+		return bad, nil
+	}
+	off := i * t.ChunkSize
+	chunkEnd := off + t.ChunkSize
+	if chunkEnd > t.Size {
+		chunkEnd = t.Size
+	}
+	if chunkEnd <= off {
+		chunkEnd = off + int64(len(chunk))
+	}
+	return appendRange(bad, ByteRange{off, chunkEnd}), nil
+}
+
+// checks data written to it against the tree chunk by chunk, for data that is
+// only seen once (a stream as it is decrypted); only one chunk is held at a time
+type MerkleVerifier struct {
+	t    *MerkleTree
+	buf  []byte
+	n    int   // bytes of the current chunk in buf
+	i    int64 // index of the current chunk
+	size int64
+	bad  []ByteRange
+	err  error
+}
+
+// creating func to start checking a file written to the returned verifier
+func (t *MerkleTree) NewVerifier() *MerkleVerifier {
+	return &MerkleVerifier{t: t, buf: make([]byte, t.ChunkSize)}
+}
+
+func (v *MerkleVerifier) Write(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	written := len(p)
+	v.size += int64(written)
+	for len(p) > 0 {
+		c := copy(v.buf[v.n:], p)
+		v.n += c
+		p = p[c:]
+		if v.n == len(v.buf) {
+			v.flush()
+		}
+	}
+	return written, v.err
+}
+
+func (v *MerkleVerifier) flush() {
+	if v.err == nil && v.i < int64(len(v.t.Leaves)) {
+		v.bad, v.err = v.t.checkChunk(v.bad, v.i, v.buf[:v.n])
+	}
+	v.i++
+	v.n = 0
+}
+
+// creating func to check the last chunk and return the corrupted byte ranges, like Verify
+func (v *MerkleVerifier) Finish() ([]ByteRange, error) {
+	// an empty file is one empty chunk
+	if v.n > 0 || v.i == 0 {
+		v.flush()
+	}
+	Wipe(v.buf)
+	if v.err != nil {
+		return nil, v.err
+	}
+	if v.size != v.t.Size {
+		lo, hi := min(v.size, v.t.Size), max(v.size, v.t.Size)
+		v.bad = appendRange(v.bad, ByteRange{lo, hi})
+	}
+	return mergeRanges(v.bad), nil
+}
+
+func appendRange(ranges []ByteRange, r ByteRange) []ByteRange {
+	if r.End <= r.Start {
+		return ranges
+	}
+	return append(ranges, r)
+}
+
+// merging overlapping and touching ranges, ranges must be sorted by Start
+func mergeRanges(ranges []ByteRange) []ByteRange {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	// the size-change range may have been added first, keep the list sorted
+	for i := 1; i < len(ranges); i++ {
+		for j := i; j > 0 && ranges[j].Start < ranges[j-1].Start; j-- {
+			ranges[j], ranges[j-1] = ranges[j-1], ranges[j]
+		}
+	}
+	merged := []ByteRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// creating func to write the tree next to the file it describes
+func WriteMerkleFile(path string, tree *MerkleTree) error {
+	data, err := yaml.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("failed to marshal merkle tree: %v", err)
+	}
+	return WriteFileAtomic(path+".merkle.yaml", data, WriteOptions{Perm: 0644, Replace: true})
+}
+
+// creating func to load a tree from a .merkle.yaml file
+func LoadMerkleFile(manifestPath string) (*MerkleTree, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var tree MerkleTree
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to parse merkle file: %v", err)
+	}
+	if len(tree.Leaves) == 0 {
+		return nil, fmt.Errorf("merkle file %s is incomplete", manifestPath)
+	}
+	if err := ValidMerkleChunkSize(tree.ChunkSize); err != nil {
+		return nil, fmt.Errorf("merkle file %s: %v", manifestPath, err)
+	}
+	return &tree, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// the streaming verifier has to find the same ranges as Verify on the whole file
+func TestMerkleVerifierMatchesVerify(t *testing.T) {
+	const chunk = 64
+	key := bytes.Repeat([]byte{9}, 32)
+	orig := streamPlaintext(5*chunk + 10)
+	tree, err := BuildMerkleTree(bytes.NewReader(orig), chunk, "sha256", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), orig...)
+	flipped[chunk+3] ^= 1
+	flipped[4*chunk] ^= 1
+	cases := map[string][]byte{
+		"intact":    orig,
+		"flipped":   flipped,
+		"truncated": orig[:3*chunk+1],
+		"extended":  append(append([]byte(nil), orig...), 1, 2, 3),
+		"empty":     nil,
+	}
+	for name, data := range cases {
+		want, err := tree.Verify(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// odd write sizes, so chunks are split across writes
+		v := tree.NewVerifier()
+		for i := 0; i < len(data); i += 7 {
+			v.Write(data[i:min(i+7, len(data))])
+		}
+		got, err := v.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: verifier found %v, Verify %v", name, got, want)
+		}
+		if name != "intact" && len(got) == 0 {
+			t.Errorf("%s: no corruption found", name)
+		}
+	}
+}
+
+func TestMerkleVerifierNeedsKey(t *testing.T) {
+	tree, err := BuildMerkleTree(bytes.NewReader([]byte("data")), 16, "sha256", []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.SetKey(nil)
+	v := tree.NewVerifier()
+	v.Write([]byte("data"))
+	if _, err := v.Finish(); err != ErrMerkleKeyRequired {
+		t.Errorf("got %v, want ErrMerkleKeyRequired", err)
+	}
+}
@@ -1,18 +1,99 @@
 package utils
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
+
 	"gopkg.in/yaml.v3"
 )
 
 type Metadata struct {
-	OriginalFilename	string	`yaml:"original_filename"`
-	Scheme	string		`yaml:"scheme"`
-	KeyDerivation	string	`yaml:"key_derivation"`
-	Salt		string		`yaml:"salt,omitempty"`
-	Timestamp 	time.Time	`yaml:"timestamp"`	
+	OriginalFilename string    `yaml:"original_filename"`
+	Scheme           string    `yaml:"scheme"`
+	KeyDerivation    string    `yaml:"key_derivation"`
+	Salt             string    `yaml:"salt,omitempty"`
+	Timestamp        time.Time `yaml:"timestamp"`
+	// set when a Merkle chunk manifest was written next to the file (run --merkle)
+	MerkleRoot      string `yaml:"merkle_root,omitempty"`
+	MerkleAlgo      string `yaml:"merkle_algo,omitempty"`
+	MerkleChunkSize int64  `yaml:"merkle_chunk_size,omitempty"`
+	// mode (octal, e.g. "0640") and modification time of the original file,
+	// restored on the decrypted output
+	Mode    string    `yaml:"mode,omitempty"`
+	ModTime time.Time `yaml:"mtime,omitempty"`
+	// with encrypted names (run --encrypt-names): the plaintext path relative to
+	// the encrypted tree, and everything but the fields needed to decrypt sealed
+	// into Sealed (base64), so the .meta.yaml doesn't give the names away
+	OriginalPath string `yaml:"original_path,omitempty"`
+	Sealed       string `yaml:"sealed,omitempty"`
+}
+
+// seals and opens the private part of the metadata, crypto.SIV fits
+type MetadataSealer interface {
+	Seal(plaintext []byte, ad ...[]byte) []byte
+	Open(ciphertext []byte, ad ...[]byte) ([]byte, error)
+}
+
+var metadataAD = []byte("crypto-cli metadata v1")
+
+// creating func to seal the metadata: only scheme, key derivation, salt and
+// timestamp stay readable (they are needed to get the key), the rest goes into Sealed.
+// name (the file's encrypted path) is authenticated with it, so sealed metadata
+// moved next to another file no longer opens
+func (m Metadata) Seal(s MetadataSealer, name string) (Metadata, error) {
+	data, err := yaml.Marshal(&m)
+	if err != nil {
+		return m, fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+	return Metadata{
+		Scheme:        m.Scheme,
+		KeyDerivation: m.KeyDerivation,
+		Salt:          m.Salt,
+		Timestamp:     m.Timestamp,
+		Sealed:        base64.StdEncoding.EncodeToString(s.Seal(data, metadataAD, []byte(name))),
+	}, nil
+}
+
+// creating func to open sealed metadata under the name it was sealed for,
+// metadata that isn't sealed comes back as is
+func (m Metadata) Unseal(s MetadataSealer, name string) (Metadata, error) {
+	if m.Sealed == "" {
+		return m, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(m.Sealed)
+	if err != nil {
+		return m, fmt.Errorf("%w: sealed metadata: %v", ErrTruncated, err)
+	}
+	data, err := s.Open(sealed, metadataAD, []byte(name))
+	if err != nil {
+		return m, fmt.Errorf("sealed metadata: %w", err)
+	}
+	var open Metadata
+	if err := yaml.Unmarshal(data, &open); err != nil {
+		return m, fmt.Errorf("sealed metadata: %v", err)
+	}
+	return open, nil
+}
+
+// creating func to record the mode and mtime of the original file
+func (m *Metadata) SetFileInfo(info os.FileInfo) {
+	m.Mode = fmt.Sprintf("%04o", info.Mode().Perm())
+	m.ModTime = info.ModTime().UTC()
+}
+
+// the recorded mode of the original file, false when there is none
+func (m Metadata) FileMode() (os.FileMode, bool) {
+	if m.Mode == "" {
+		return 0, false
+	}
+	mode, err := strconv.ParseUint(m.Mode, 8, 32)
+	if err != nil {
+		return 0, false
+	}
+	return os.FileMode(mode).Perm(), true
 }
 
 func WriteMetadataFile(path string, meta Metadata) error {
@@ -21,7 +102,7 @@ func WriteMetadataFile(path string, meta Metadata) error {
 		return fmt.Errorf("failed to marshal metadata: %v", err)
 	}
 	metaPath := path + ".meta.yaml"
-	return os.WriteFile(metaPath, yamlBytes, 0644)
+	return WriteFileAtomic(metaPath, yamlBytes, WriteOptions{Perm: 0644, Replace: true})
 }
 
 // Read Metadata file
@@ -33,4 +114,4 @@ func LoadMetadataFile(path string) (Metadata, error) {
 	}
 	err = yaml.Unmarshal(data, &meta)
 	return meta, err
-}
\ No newline at end of file
+}
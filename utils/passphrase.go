@@ -0,0 +1,404 @@
+package utils
+
+// password strength estimation in the spirit of zxcvbn:
+// the password is split into known patterns (common passwords, dictionary words,
+// sequences, repeats, keyboard walks, years) and the cheapest way to cover it
+// with patterns and brute-forced characters gives the entropy estimate.
+// the bundled wordlist (EFF large list) is also used for diceware passphrases
+
+import (
+	"bufio"
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// EFF large wordlist in diceware format: five dice rolls, a tab, then the word
+//
+//go:embed wordlist.txt
+var wordlistData string
+
+var (
+	dicewareOnce  sync.Once
+	dicewareWords []string
+	dicewareRank  map[string]int
+)
+
+// most common leaked passwords, ordered by frequency
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"696969", "shadow", "master", "666666", "qwertyuiop", "123321", "mustang", "1234567890",
+	"michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000", "qazwsx",
+	"123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"2000", "charlie", "robert", "thomas", "hockey", "ranger", "daniel", "starwars",
+	"klaster", "112233", "george", "computer", "michelle", "jessica", "pepper", "1111",
+	"zxcvbn", "555555", "11111111", "131313", "freedom", "777777", "pass", "maggie",
+	"159753", "aaaaaa", "ginger", "princess", "joshua", "cheese", "amanda", "summer",
+	"love", "ashley", "nicole", "chelsea", "biteme", "matthew", "access", "yankees",
+	"987654321", "dallas", "austin", "thunder", "taylor", "matrix", "admin", "welcome",
+	"secret", "passw0rd", "login", "changeme", "default", "root", "test", "guest",
+}
+
+// keyboard rows used to spot keyboard walks like "asdf" or "poiuy"
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890"}
+
+// common l33t substitutions mapped back to letters
+var l33tTable = map[rune]rune{
+	'4': 'a', '@': 'a', '3': 'e', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't',
+}
+
+// result of estimating a password
+type PasswordStrength struct {
+	Entropy  float64
+	Length   int
+	Score    int
+	Banned   bool
+	Warnings []string
+}
+
+// one pattern found inside the password
+type passwordMatch struct {
+	start, end int
+	entropy    float64
+	warning    string
+	banned     bool
+}
+
+// creating func to return the bundled diceware wordlist
+func DicewareWords() []string {
+	dicewareOnce.Do(func() {
+		dicewareWords = parseWordList(wordlistData)
+		dicewareRank = make(map[string]int, len(dicewareWords))
+		for i, w := range dicewareWords {
+			dicewareRank[w] = i + 1
+		}
+	})
+	return dicewareWords
+}
+
+// creating func to load a word list from a local file (one word per line, # for comments)
+func LoadWordList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read word list: %w", err)
+	}
+	return parseWordList(string(data)), nil
+}
+
+// lines may be plain words or diceware "11111<tab>word" entries
+func parseWordList(data string) []string {
+	var words []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		words = append(words, strings.ToLower(fields[len(fields)-1]))
+	}
+	return words
+}
+
+// creating func to estimate the strength of a password
+// banned words count as free guesses and always produce a warning
+func EstimatePassword(password string, banned []string) PasswordStrength {
+	runes := []rune(password)
+	n := len(runes)
+	strength := PasswordStrength{Length: n}
+	if n == 0 {
+		strength.Warnings = []string{"password is empty"}
+		return strength
+	}
+
+	matches := findPasswordMatches(runes, banned)
+	for _, m := range matches {
+		if m.banned {
+			strength.Banned = true
+		}
+	}
+	bruteforce := math.Log2(float64(charsetSize(runes)))
+
+	// minimum entropy to cover runes[:i], and the match used to get there
+	best := make([]float64, n+1)
+	via := make([]*passwordMatch, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = best[i-1] + bruteforce
+		for j := range matches {
+			m := &matches[j]
+			if m.end == i && best[m.start]+m.entropy < best[i] {
+				best[i] = best[m.start] + m.entropy
+				via[i] = m
+			}
+		}
+	}
+	strength.Entropy = best[n]
+
+	// walking back through the cheapest cover to collect warnings
+	seen := map[string]bool{}
+	for i := n; i > 0; {
+		m := via[i]
+		if m == nil {
+			i--
+			continue
+		}
+		if !seen[m.warning] {
+			seen[m.warning] = true
+			strength.Warnings = append([]string{m.warning}, strength.Warnings...)
+		}
+		i = m.start
+	}
+
+	switch {
+	case strength.Entropy < 28:
+		strength.Score = 0
+	case strength.Entropy < 36:
+		strength.Score = 1
+	case strength.Entropy < 60:
+		strength.Score = 2
+	case strength.Entropy < 80:
+		strength.Score = 3
+	default:
+		strength.Score = 4
+	}
+	return strength
+}
+
+// size of the character classes used by the password
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
+
+func findPasswordMatches(runes []rune, banned []string) []passwordMatch {
+	DicewareWords()
+	lower := []rune(strings.ToLower(string(runes)))
+	unl33t := make([]rune, len(lower))
+	for i, r := range lower {
+		if sub, ok := l33tTable[r]; ok {
+			unl33t[i] = sub
+		} else {
+			unl33t[i] = r
+		}
+	}
+
+	bannedSet := make(map[string]bool, len(banned))
+	for _, w := range banned {
+		bannedSet[strings.ToLower(w)] = true
+	}
+	commonRank := make(map[string]int, len(commonPasswords))
+	for i, w := range commonPasswords {
+		commonRank[w] = i + 1
+	}
+
+	var matches []passwordMatch
+	n := len(runes)
+
+	// dictionary matches, on the plain and the de-l33ted text
+	for i := 0; i < n; i++ {
+		for j := i + 3; j <= n; j++ {
+			for c, candidate := range [][]rune{lower, unl33t} {
+				word := string(candidate[i:j])
+				extra := caseEntropy(runes[i:j])
+				if c == 1 {
+					extra += l33tEntropy(lower[i:j], unl33t[i:j])
+				}
+				switch {
+				case bannedSet[word]:
+					matches = append(matches, passwordMatch{i, j, extra, fmt.Sprintf("contains banned word %q", word), true})
+				case commonRank[word] > 0:
+					matches = append(matches, passwordMatch{i, j, math.Log2(float64(commonRank[word])) + extra, "contains a common password", false})
+				case dicewareRank[word] > 0:
+					matches = append(matches, passwordMatch{i, j, math.Log2(float64(len(dicewareWords))) + extra, "contains a dictionary word", false})
+				}
+			}
+		}
+	}
+
+	// sequences (abcd, 9876) and repeats (aaaa)
+	for i := 0; i < n; {
+		j := i + 1
+		for j < n && lower[j] == lower[i] {
+			j++
+		}
+		if j-i >= 3 {
+			base := math.Log2(float64(charsetSize(runes[i : i+1])))
+			matches = append(matches, passwordMatch{i, j, base + math.Log2(float64(j-i)), "contains repeated characters", false})
+			i = j
+			continue
+		}
+		i++
+	}
+	for i := 0; i+2 < n; i++ {
+		delta := lower[i+1] - lower[i]
+		if delta != 1 && delta != -1 {
+			continue
+		}
+		j := i + 1
+		for j+1 < n && lower[j+1]-lower[j] == delta && sameClass(lower[j], lower[j+1]) {
+			j++
+		}
+		if j-i+1 >= 3 && sameClass(lower[i], lower[i+1]) {
+			base := math.Log2(26)
+			if unicode.IsDigit(lower[i]) {
+				base = math.Log2(10)
+			}
+			if lower[i] == 'a' || lower[i] == '1' || lower[i] == '0' {
+				base = 1
+			}
+			if delta == -1 {
+				base++
+			}
+			matches = append(matches, passwordMatch{i, j + 1, base + math.Log2(float64(j-i+1)), "contains a sequence", false})
+		}
+	}
+
+	// keyboard walks along a row, in either direction
+	for _, row := range keyboardRows {
+		reversed := reverseString(row)
+		for i := 0; i < n; i++ {
+			for j := i + 4; j <= n; j++ {
+				token := string(lower[i:j])
+				if strings.Contains(row, token) || strings.Contains(reversed, token) {
+					matches = append(matches, passwordMatch{i, j, math.Log2(47) + math.Log2(float64(j-i)), "contains a keyboard pattern", false})
+				}
+			}
+		}
+	}
+
+	// years between 1900 and 2099
+	for i := 0; i+4 <= n; i++ {
+		token := string(lower[i : i+4])
+		if (strings.HasPrefix(token, "19") || strings.HasPrefix(token, "20")) && isDigits(token) {
+			matches = append(matches, passwordMatch{i, i + 4, math.Log2(200), "contains a year", false})
+		}
+	}
+	return matches
+}
+
+// extra bits for upper case letters in a dictionary match
+func caseEntropy(token []rune) float64 {
+	upper := 0
+	for _, r := range token {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case upper == len(token) || (upper == 1 && unicode.IsUpper(token[0])):
+		return 1
+	default:
+		return float64(upper)
+	}
+}
+
+// extra bits for l33t substitutions in a dictionary match
+func l33tEntropy(lower, unl33t []rune) float64 {
+	subs := 0
+	for i := range lower {
+		if lower[i] != unl33t[i] {
+			subs++
+		}
+	}
+	return float64(subs)
+}
+
+func sameClass(a, b rune) bool {
+	return unicode.IsDigit(a) == unicode.IsDigit(b) && unicode.IsLetter(a) == unicode.IsLetter(b)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func reverseString(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// creating func to generate a diceware passphrase from the bundled wordlist
+// returns the passphrase and its exact entropy in bits
+func GeneratePassphrase(words int, separator string) (string, float64, error) {
+	list := DicewareWords()
+	if words < 1 {
+		return "", 0, fmt.Errorf("passphrase needs at least one word")
+	}
+	picked := make([]string, words)
+	for i := range picked {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(list))))
+		if err != nil {
+			return "", 0, err
+		}
+		picked[i] = list[idx.Int64()]
+	}
+	return strings.Join(picked, separator), float64(words) * math.Log2(float64(len(list))), nil
+}
+
+// characters used for random passwords: printable ASCII without space
+const randomPasswordCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// creating func to generate a random password of the given length
+// returns the password and its exact entropy in bits
+func GenerateRandomPassword(length int) (string, float64, error) {
+	if length < 1 {
+		return "", 0, fmt.Errorf("password length must be at least 1")
+	}
+	out := make([]byte, length)
+	max := big.NewInt(int64(len(randomPasswordCharset)))
+	for i := range out {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", 0, err
+		}
+		out[i] = randomPasswordCharset[idx.Int64()]
+	}
+	return string(out), float64(length) * math.Log2(float64(len(randomPasswordCharset))), nil
+}
@@ -0,0 +1,298 @@
+package utils
+
+// password hashes for storage, in the PHC string format
+// (https://github.com/P-H-C/phc-string-format):
+//
+//   $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+//   $scrypt$ln=17,r=8,p=1$<salt>$<hash>
+//   $pbkdf2-sha256$i=600000$<salt>$<hash>
+//
+// salt and hash are unpadded standard base64. bcrypt keeps its own
+// modular crypt format ($2a$12$...), which the PHC spec leaves as is.
+// verification reads the algorithm and its parameters back from the string
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	phcSaltSize = 16
+	phcHashSize = 32
+)
+
+var PasswordHashAlgorithms = []string{"argon2id", "bcrypt", "scrypt", "pbkdf2-sha256"}
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// cost settings for new hashes, one set per algorithm
+type PasswordHashOptions struct {
+	Argon2       Argon2Params
+	Scrypt       ScryptParams
+	PBKDF2Rounds int
+	BcryptCost   int
+}
+
+func DefaultPasswordHashOptions() PasswordHashOptions {
+	return PasswordHashOptions{
+		Argon2:       DefaultArgon2Params,
+		Scrypt:       DefaultScryptParams,
+		PBKDF2Rounds: DefaultPBKDF2Rounds,
+		BcryptCost:   DefaultBcryptCost,
+	}
+}
+
+// one name=value parameter of a PHC string, kept in order
+type PHCParam struct {
+	Name  string
+	Value string
+}
+
+// a parsed PHC string, Version is 0 when the string has none
+type PHCString struct {
+	ID      string
+	Version int
+	Params  []PHCParam
+	Salt    []byte
+	Hash    []byte
+}
+
+func (p PHCString) String() string {
+	var b strings.Builder
+	b.WriteString("$" + p.ID)
+	if p.Version != 0 {
+		fmt.Fprintf(&b, "$v=%d", p.Version)
+	}
+	if len(p.Params) > 0 {
+		pairs := make([]string, len(p.Params))
+		for i, kv := range p.Params {
+			pairs[i] = kv.Name + "=" + kv.Value
+		}
+		b.WriteString("$" + strings.Join(pairs, ","))
+	}
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.Salt))
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.Hash))
+	return b.String()
+}
+
+// creating func to look up a parameter as an unsigned integer
+func (p PHCString) Uint(name string, bits int) (uint64, error) {
+	for _, kv := range p.Params {
+		if kv.Name == name {
+			v, err := strconv.ParseUint(kv.Value, 10, bits)
+			if err != nil {
+				return 0, fmt.Errorf("%w: bad value for %s", ErrMalformedHash, name)
+			}
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: missing parameter %s", ErrMalformedHash, name)
+}
+
+// creating func to parse $id[$v=version][$params]$salt$hash
+func ParsePHC(s string) (PHCString, error) {
+	var p PHCString
+	fields := strings.Split(s, "$")
+	if len(fields) < 4 || fields[0] != "" || fields[1] == "" {
+		return p, ErrMalformedHash
+	}
+	p.ID = fields[1]
+	rest := fields[2:]
+	if strings.HasPrefix(rest[0], "v=") {
+		v, err := strconv.Atoi(strings.TrimPrefix(rest[0], "v="))
+		if err != nil {
+			return p, fmt.Errorf("%w: bad version", ErrMalformedHash)
+		}
+		p.Version = v
+		rest = rest[1:]
+	}
+	if len(rest) == 3 {
+		for _, pair := range strings.Split(rest[0], ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok || name == "" {
+				return p, fmt.Errorf("%w: bad parameter %q", ErrMalformedHash, pair)
+			}
+			p.Params = append(p.Params, PHCParam{name, value})
+		}
+		rest = rest[1:]
+	}
+	if len(rest) != 2 {
+		return p, ErrMalformedHash
+	}
+	var err error
+	if p.Salt, err = base64.RawStdEncoding.DecodeString(rest[0]); err != nil {
+		return p, fmt.Errorf("%w: bad salt encoding", ErrMalformedHash)
+	}
+	if p.Hash, err = base64.RawStdEncoding.DecodeString(rest[1]); err != nil {
+		return p, fmt.Errorf("%w: bad hash encoding", ErrMalformedHash)
+	}
+	return p, nil
+}
+
+// creating func to hash a password for storage with a random salt
+func HashPassword(password []byte, algo string, opts PasswordHashOptions) (string, error) {
+	if algo == "bcrypt" {
+		h, err := bcrypt.GenerateFromPassword(password, opts.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(h), nil
+	}
+	salt, err := GenerateSalt()
+	if err != nil {
+		return "", err
+	}
+	var p PHCString
+	switch algo {
+	case "argon2id":
+		p = PHCString{ID: algo, Version: argon2.Version, Params: argon2PHCParams(opts.Argon2)}
+	case "scrypt":
+		p = PHCString{ID: algo, Params: scryptPHCParams(opts.Scrypt)}
+	case "pbkdf2-sha256":
+		p = PHCString{ID: algo, Params: []PHCParam{{"i", strconv.Itoa(opts.PBKDF2Rounds)}}}
+	default:
+		return "", fmt.Errorf("unsupported password hash: %s (available: %s)", algo, strings.Join(PasswordHashAlgorithms, ", "))
+	}
+	p.Salt = salt
+	p.Hash, err = derivePHC(password, p, phcHashSize)
+	if err != nil {
+		return "", err
+	}
+	return p.String(), nil
+}
+
+// creating func to check a password against a stored hash, in constant time
+func VerifyPassword(password []byte, encoded string) (bool, error) {
+	if isBcryptHash(encoded) {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), password)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	p, err := ParsePHC(encoded)
+	if err != nil {
+		return false, err
+	}
+	if len(p.Hash) < 16 || len(p.Hash) > 64 {
+		return false, fmt.Errorf("%w: unexpected hash length %d", ErrMalformedHash, len(p.Hash))
+	}
+	got, err := derivePHC(password, p, len(p.Hash))
+	if err != nil {
+		return false, err
+	}
+	defer Wipe(got)
+	return subtle.ConstantTimeCompare(got, p.Hash) == 1, nil
+}
+
+// creating func to tell whether a stored hash is weaker than the given options
+// (different algorithm or lower cost), so it can be replaced on the next login
+func PasswordHashNeedsRehash(encoded, algo string, opts PasswordHashOptions) bool {
+	if isBcryptHash(encoded) {
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return algo != "bcrypt" || err != nil || cost < opts.BcryptCost
+	}
+	p, err := ParsePHC(encoded)
+	if err != nil || p.ID != algo {
+		return true
+	}
+	switch p.ID {
+	case "argon2id":
+		got, err := argon2ParamsFromPHC(p)
+		return err != nil || p.Version != argon2.Version || got.Memory < opts.Argon2.Memory || got.Time < opts.Argon2.Time
+	case "scrypt":
+		got, err := scryptParamsFromPHC(p)
+		return err != nil || got.LogN < opts.Scrypt.LogN || got.R < opts.Scrypt.R
+	case "pbkdf2-sha256":
+		i, err := p.Uint("i", 32)
+		return err != nil || int(i) < opts.PBKDF2Rounds
+	}
+	return true
+}
+
+// runs the KDF named by a PHC string with its parameters
+func derivePHC(password []byte, p PHCString, length int) ([]byte, error) {
+	switch p.ID {
+	case "argon2id":
+		if p.Version != argon2.Version {
+			return nil, fmt.Errorf("unsupported argon2 version %d", p.Version)
+		}
+		params, err := argon2ParamsFromPHC(p)
+		if err != nil {
+			return nil, err
+		}
+		return DeriveArgon2id(password, p.Salt, params, length)
+	case "scrypt":
+		params, err := scryptParamsFromPHC(p)
+		if err != nil {
+			return nil, err
+		}
+		return DeriveScrypt(password, p.Salt, params, length)
+	case "pbkdf2-sha256":
+		i, err := p.Uint("i", 32)
+		if err != nil {
+			return nil, err
+		}
+		return DerivePBKDF2(password, p.Salt, int(i), length)
+	}
+	return nil, fmt.Errorf("unsupported password hash: %s", p.ID)
+}
+
+func argon2PHCParams(a Argon2Params) []PHCParam {
+	return []PHCParam{
+		{"m", strconv.FormatUint(uint64(a.Memory), 10)},
+		{"t", strconv.FormatUint(uint64(a.Time), 10)},
+		{"p", strconv.FormatUint(uint64(a.Parallelism), 10)},
+	}
+}
+
+func argon2ParamsFromPHC(p PHCString) (Argon2Params, error) {
+	m, err := p.Uint("m", 32)
+	if err != nil {
+		return Argon2Params{}, err
+	}
+	t, err := p.Uint("t", 32)
+	if err != nil {
+		return Argon2Params{}, err
+	}
+	par, err := p.Uint("p", 8)
+	if err != nil {
+		return Argon2Params{}, err
+	}
+	return Argon2Params{Memory: uint32(m), Time: uint32(t), Parallelism: uint8(par)}, nil
+}
+
+func scryptPHCParams(s ScryptParams) []PHCParam {
+	return []PHCParam{
+		{"ln", strconv.Itoa(int(s.LogN))},
+		{"r", strconv.Itoa(s.R)},
+		{"p", strconv.Itoa(s.P)},
+	}
+}
+
+func scryptParamsFromPHC(p PHCString) (ScryptParams, error) {
+	ln, err := p.Uint("ln", 8)
+	if err != nil {
+		return ScryptParams{}, err
+	}
+	r, err := p.Uint("r", 16)
+	if err != nil {
+		return ScryptParams{}, err
+	}
+	par, err := p.Uint("p", 16)
+	if err != nil {
+		return ScryptParams{}, err
+	}
+	return ScryptParams{LogN: uint8(ln), R: int(r), P: int(par)}, nil
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
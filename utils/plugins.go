@@ -1,5 +1,10 @@
 package utils
 
+import (
+	"context"
+	"io"
+	"sort"
+)
 
 // creating a plugin interface
 type Plugin interface {
@@ -9,6 +14,41 @@ type Plugin interface {
 
 }
 
+// optional interface for plugins that know the size of their key, used by keygen.
+// plugins without it fall back to the size registered in KeyLen
+type KeySizer interface {
+	KeySize() int
+}
+
+// creating func to get the key size of a plugin, false when it is unknown
+func PluginKeySize(plugin Plugin) (int, bool) {
+	if ks, ok := plugin.(KeySizer); ok {
+		return ks.KeySize(), true
+	}
+	size, ok := KeyLen[plugin.Name()]
+	return size, ok
+}
+
+// optional interface for plugins that want per-context subkeys
+// when UsesSubkeys returns true the plugin receives an HKDF subkey derived from
+// the master key and the context instead of the master key itself
+type SubkeyPlugin interface {
+	UsesSubkeys() bool
+}
+
+// optional interface for plugins whose ciphertext carries an authentication tag
+// (AEAD), so a successful Decrypt already proves the data wasn't modified
+type AEADPlugin interface {
+	Authenticated() bool
+}
+
+// optional interface for plugins that can encrypt a stream in constant memory,
+// used for --input - and --output -. the stream format is binary, see stream.go
+type StreamPlugin interface {
+	EncryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error
+	DecryptStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error
+}
+
 // creating a plugin registry
 // first: creating variable pluginRegistry
 var pluginRegistry = make(map[string]Plugin)
@@ -26,10 +66,12 @@ func GetPlugin(name string) (Plugin, bool) {
 }
 
 // creating func to list plugins
+// names are sorted so output built from the list is stable
 func ListPlugins() []string {
 	keys := make([]string, 0, len(pluginRegistry))
 	for k := range pluginRegistry {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 	return keys
 }
\ No newline at end of file
@@ -0,0 +1,417 @@
+package utils
+
+// one progress display for a whole batch, shared by every worker.
+// on a terminal it draws an aggregate bar (percent, bytes, throughput, ETA and
+// files done) with one line per worker under it, redrawn in place. When stdout
+// or stderr is not a terminal it logs a summary line every --progress-interval instead,
+// so CI logs get a heartbeat rather than a wall of carriage returns.
+//
+// log lines and results written while the bar is up clear it first and redraw
+// it after (see progressConsole), so the two never overdraw each other
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// values of --progress-style
+const (
+	ProgressAuto = "auto" // bar on a terminal, log lines otherwise
+	ProgressBar  = "bar"
+	ProgressLog  = "log"
+	ProgressNone = "none"
+)
+
+var ProgressStyles = []string{ProgressAuto, ProgressBar, ProgressLog, ProgressNone}
+
+// at most this many worker lines are drawn, busy workers first
+const maxWorkerLines = 8
+
+var (
+	progressStyle    = ProgressAuto
+	progressInterval = 10 * time.Second
+
+	// the display currently on screen, log lines go around it
+	activeMu       sync.Mutex
+	activeProgress *Progress
+)
+
+// creating func to pick the style for every later NewProgress
+// interval is the time between two log lines in the log style
+func SetProgressStyle(style string, interval time.Duration) error {
+	switch style {
+	case ProgressAuto, ProgressBar, ProgressLog, ProgressNone:
+	default:
+		return fmt.Errorf("unknown progress style: %s (choose %s)", style, strings.Join(ProgressStyles, ", "))
+	}
+	if interval <= 0 {
+		return fmt.Errorf("progress interval must be positive")
+	}
+	progressStyle = style
+	progressInterval = interval
+	return nil
+}
+
+// the progress of one batch
+// all methods are safe on a nil *Progress, which is what NewProgress returns
+// when progress is turned off
+type Progress struct {
+	mu        sync.Mutex
+	w         io.Writer
+	style     string // bar or log, auto is resolved by NewProgress
+	desc      string
+	total     int64 // 0 when the size isn't known (e.g. stdin)
+	done      int64
+	files     int
+	filesDone int
+	workers   []*WorkerProgress
+	start     time.Time
+	lines     int // lines drawn by the last render, to move back over them
+	finished  bool
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// the progress of one worker, fed by the file it is on
+type WorkerProgress struct {
+	p    *Progress
+	id   int
+	name string
+	size int64
+	done int64
+	busy bool
+}
+
+// creating func to start the display for a batch of files totalling total bytes
+// processed by workers goroutines (0 for a single aggregate line)
+func NewProgress(desc string, total int64, files, workers int) *Progress {
+	style := progressStyle
+	if style == ProgressAuto {
+		// the bar only makes sense when someone is watching: output piped or
+		// redirected means a script or CI job, which gets log lines
+		style = ProgressLog
+		if term.IsTerminal(int(os.Stderr.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+			style = ProgressBar
+		}
+	}
+	if style == ProgressNone {
+		return nil
+	}
+	p := &Progress{
+		w: os.Stderr, style: style, desc: desc, total: total, files: files,
+		start: time.Now(), stop: make(chan struct{}), stopped: make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		p.workers = append(p.workers, &WorkerProgress{p: p, id: i})
+	}
+	activeMu.Lock()
+	activeProgress = p
+	activeMu.Unlock()
+
+	tick := 150 * time.Millisecond
+	if style == ProgressLog {
+		tick = progressInterval
+	}
+	go p.loop(tick)
+	return p
+}
+
+func (p *Progress) loop(tick time.Duration) {
+	defer close(p.stopped)
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	if p.style == ProgressBar {
+		p.mu.Lock()
+		p.render()
+		p.mu.Unlock()
+	}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			if p.style == ProgressBar {
+				p.mu.Lock()
+				p.render()
+				p.mu.Unlock()
+				continue
+			}
+			// built under the lock, logged outside it: the log writer takes the lock too
+			p.mu.Lock()
+			line := p.summary()
+			p.mu.Unlock()
+			Info("%s", line)
+		}
+	}
+}
+
+// bytes processed outside any worker, so a *Progress can be used as an io.Writer
+func (p *Progress) Write(b []byte) (int, error) {
+	if p == nil {
+		return len(b), nil
+	}
+	p.mu.Lock()
+	p.done += int64(len(b))
+	p.mu.Unlock()
+	return len(b), nil
+}
+
+// creating func to count a finished file that went through Write rather than a worker
+func (p *Progress) FileDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.filesDone++
+	p.mu.Unlock()
+}
+
+// the progress of worker i, nil when there is no such worker
+func (p *Progress) Worker(i int) *WorkerProgress {
+	if p == nil || i < 0 || i >= len(p.workers) {
+		return nil
+	}
+	return p.workers[i]
+}
+
+// creating func to stop the display and print the throughput summary
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	activeMu.Lock()
+	if activeProgress == p {
+		activeProgress = nil
+	}
+	activeMu.Unlock()
+
+	p.mu.Lock()
+	p.finished = true
+	elapsed := time.Since(p.start)
+	done := ThroughputSummary(p.filesDone, p.done, elapsed)
+	if p.style == ProgressBar {
+		// the worker lines go, the summary takes the place of the bar
+		p.clear()
+		fmt.Fprintf(p.w, "%s: %s\n", p.desc, done)
+	}
+	p.mu.Unlock()
+	if p.style == ProgressLog {
+		Info("%s: %s", p.desc, done)
+	}
+}
+
+// creating func to mark the worker busy with a file of size bytes
+func (w *WorkerProgress) Start(name string, size int64) {
+	if w == nil {
+		return
+	}
+	w.p.mu.Lock()
+	w.name, w.size, w.done, w.busy = name, size, 0, true
+	w.p.mu.Unlock()
+}
+
+func (w *WorkerProgress) Write(b []byte) (int, error) {
+	if w == nil {
+		return len(b), nil
+	}
+	w.p.mu.Lock()
+	w.done += int64(len(b))
+	w.p.done += int64(len(b))
+	w.p.mu.Unlock()
+	return len(b), nil
+}
+
+// creating func to count every byte read from r, r itself when w is nil
+func (w *WorkerProgress) Reader(r io.Reader) io.Reader {
+	if w == nil {
+		return r
+	}
+	return io.TeeReader(r, w)
+}
+
+// creating func to mark the worker's file as finished
+func (w *WorkerProgress) Done() {
+	if w == nil {
+		return
+	}
+	w.p.mu.Lock()
+	w.busy = false
+	w.p.filesDone++
+	w.p.mu.Unlock()
+}
+
+// one line: percent, bytes, rate, ETA and files
+// must be called with mu held
+func (p *Progress) summary() string {
+	elapsed := time.Since(p.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed.Seconds()
+	}
+	var b strings.Builder
+	b.WriteString(p.desc + ":")
+	if p.total > 0 {
+		fmt.Fprintf(&b, " %3.0f%% %s/%s", 100*float64(p.done)/float64(p.total), FormatSize(p.done), FormatSize(p.total))
+	} else {
+		fmt.Fprintf(&b, " %s", FormatSize(p.done))
+	}
+	fmt.Fprintf(&b, ", %s/s", FormatSize(int64(rate)))
+	if p.total > 0 && p.done > 0 && p.done < p.total {
+		eta := time.Duration(float64(elapsed) * float64(p.total-p.done) / float64(p.done))
+		fmt.Fprintf(&b, ", ETA %s", eta.Round(time.Second))
+	}
+	if p.files > 0 {
+		fmt.Fprintf(&b, ", %d/%d file(s)", p.filesDone, p.files)
+	}
+	return b.String()
+}
+
+// redraws the bar and worker lines in place
+// must be called with mu held
+func (p *Progress) render() {
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stderr.Fd())); err == nil && w > 20 {
+		width = w
+	}
+	lines := []string{p.barLine(width)}
+	for _, w := range p.shownWorkers() {
+		line := fmt.Sprintf("  #%-2d idle", w.id+1)
+		if w.busy {
+			line = fmt.Sprintf("  #%-2d %s %s", w.id+1, bar(w.done, w.size, 12), w.name)
+			if w.size > 0 {
+				line += fmt.Sprintf(" (%s/%s)", FormatSize(w.done), FormatSize(w.size))
+			}
+		}
+		lines = append(lines, line)
+	}
+	var b strings.Builder
+	if p.lines > 0 {
+		// back to the first line of the last render
+		fmt.Fprintf(&b, "\x1b[%dF", p.lines)
+	}
+	for _, l := range lines {
+		// lines are cut to the terminal width, a wrapped line would break the cursor math
+		if len([]rune(l)) >= width {
+			l = string([]rune(l)[:width-1])
+		}
+		b.WriteString("\x1b[2K" + l + "\n")
+	}
+	io.WriteString(p.w, b.String())
+	p.lines = len(lines)
+}
+
+// must be called with mu held
+func (p *Progress) barLine(width int) string {
+	text := p.summary()
+	barWidth := width - len([]rune(text)) - 4
+	if barWidth > 40 {
+		barWidth = 40
+	}
+	if p.total <= 0 || barWidth < 10 {
+		return text
+	}
+	desc, rest, _ := strings.Cut(text, ":")
+	return desc + " " + bar(p.done, p.total, barWidth) + rest
+}
+
+// the busy workers first, then idle ones, at most maxWorkerLines
+// must be called with mu held
+func (p *Progress) shownWorkers() []*WorkerProgress {
+	shown := make([]*WorkerProgress, 0, maxWorkerLines)
+	for _, busy := range []bool{true, false} {
+		for _, w := range p.workers {
+			if w.busy == busy && len(shown) < maxWorkerLines {
+				shown = append(shown, w)
+			}
+		}
+	}
+	return shown
+}
+
+// removes the lines of the last render
+// must be called with mu held
+func (p *Progress) clear() {
+	if p.lines == 0 {
+		return
+	}
+	fmt.Fprintf(p.w, "\x1b[%dF\x1b[0J", p.lines)
+	p.lines = 0
+}
+
+func bar(done, total int64, width int) string {
+	filled := width
+	if total > 0 && done < total {
+		filled = int(int64(width) * done / total)
+	}
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+// creating func to print a byte count in binary units (1.5 MiB), for the bars and summaries
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// creating func to run fn with the bar off the screen, for a prompt
+// the bar is drawn again on the next tick
+func withProgressHidden(fn func()) {
+	activeMu.Lock()
+	p := activeProgress
+	activeMu.Unlock()
+	if p == nil || p.style != ProgressBar {
+		fn()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.finished {
+		p.clear()
+	}
+	fn()
+}
+
+// creating func to wrap a writer sharing the terminal with the bar (the
+// results on stdout), so what is written through it isn't drawn over
+func ConsoleWriter(w io.Writer) io.Writer {
+	return progressConsole{w}
+}
+
+// progressConsole is the console writer of the logger and the results: a line written
+// while a bar is on screen clears the bar, goes out, and the bar is redrawn under it
+type progressConsole struct {
+	w io.Writer
+}
+
+func (c progressConsole) Write(b []byte) (int, error) {
+	activeMu.Lock()
+	p := activeProgress
+	activeMu.Unlock()
+	if p == nil || p.style != ProgressBar {
+		return c.w.Write(b)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return c.w.Write(b)
+	}
+	p.clear()
+	n, err := c.w.Write(b)
+	p.render()
+	return n, err
+}
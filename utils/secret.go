@@ -0,0 +1,89 @@
+package utils
+
+// SecretBuffer keeps keys, passwords and decrypted plaintext out of ordinary
+// heap slices and strings: the memory is locked (where the OS allows it) so it
+// is not swapped out, and it is zeroed as soon as Destroy is called.
+// the contents never show up in logs or fmt output
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+type SecretBuffer struct {
+	mu     sync.Mutex
+	buf    []byte
+	locked bool
+}
+
+// creating func to allocate a zeroed secret buffer of the given size
+func NewSecretBuffer(size int) *SecretBuffer {
+	s := &SecretBuffer{buf: make([]byte, size)}
+	s.locked = lockMemory(s.buf)
+	return s
+}
+
+// creating func to move src into a secret buffer
+// src is wiped afterwards so only the locked copy is left
+func NewSecretBufferFrom(src []byte) *SecretBuffer {
+	s := NewSecretBuffer(len(src))
+	copy(s.buf, src)
+	Wipe(src)
+	return s
+}
+
+// Bytes returns the underlying memory, it is only valid until Destroy
+func (s *SecretBuffer) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf
+}
+
+func (s *SecretBuffer) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buf)
+}
+
+// Destroy zeroes and unlocks the memory, it is safe to call more than once
+func (s *SecretBuffer) Destroy() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf == nil {
+		return
+	}
+	Wipe(s.buf)
+	if s.locked {
+		unlockMemory(s.buf)
+		s.locked = false
+	}
+	s.buf = nil
+}
+
+// never printing the contents, whatever verb is used
+func (s *SecretBuffer) String() string   { return redacted }
+func (s *SecretBuffer) GoString() string { return redacted }
+func (s *SecretBuffer) Format(f fmt.State, verb rune) {
+	f.Write([]byte(redacted))
+}
+func (s *SecretBuffer) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// creating func to zero a byte slice in place
+func Wipe(b []byte) {
+	clear(b)
+	runtime.KeepAlive(b)
+}
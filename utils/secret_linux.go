@@ -0,0 +1,18 @@
+//go:build linux
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+// locking the pages so the secret is never written to swap
+// this fails quietly when RLIMIT_MEMLOCK is too low, the buffer is still wiped on Destroy
+func lockMemory(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	return unix.Mlock(b) == nil
+}
+
+func unlockMemory(b []byte) {
+	unix.Munlock(b)
+}
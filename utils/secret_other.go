@@ -0,0 +1,10 @@
+//go:build !linux
+
+package utils
+
+// memory locking is only implemented on Linux, elsewhere buffers are just wiped on Destroy
+func lockMemory(b []byte) bool {
+	return false
+}
+
+func unlockMemory(b []byte) {}
@@ -0,0 +1,76 @@
+package utils
+
+// overwriting a file before removing it only helps where a write lands on the
+// blocks that held the old data. Copy-on-write and log-structured file systems
+// (btrfs, ZFS, F2FS, overlay upper layers...) write new blocks instead, SSDs
+// remap writes in the flash translation layer, and snapshots or backups keep
+// their own copies. ShredCaveats reports what could be detected so the caller
+// can say so instead of promising more than was done
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// creating func to overwrite path with random data passes times (each pass
+// fsynced), truncate it, rename it to a random name and remove it
+// passes may be 0, the file is then only removed
+func ShredFile(path string, passes int) error {
+	if err := shredPreflight(path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	for i := 0; i < passes; i++ {
+		err := overwritePass(f, info.Size())
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("shred pass %d: %w", i+1, err)
+		}
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// the name is data too, it goes before the file does
+	name := make([]byte, 8)
+	rand.Read(name)
+	hidden := filepath.Join(filepath.Dir(path), "."+hex.EncodeToString(name))
+	if err := os.Rename(path, hidden); err != nil {
+		hidden = path
+	}
+	if err := os.Remove(hidden); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+func overwritePass(f *os.File, size int64) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, rand.Reader, size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
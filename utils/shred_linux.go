@@ -0,0 +1,65 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// file systems that don't overwrite in place, by statfs magic
+var cowFileSystems = map[int64]string{
+	0x9123683e: "btrfs",
+	0x2fc12fc1: "zfs",
+	0xca451a4e: "bcachefs",
+	0xf2f52010: "f2fs",
+	0x3434:     "nilfs2",
+	0x794c7630: "overlayfs",
+	0x24051905: "ubifs",
+	0x72b6:     "jffs2",
+}
+
+// creating func to refuse shredding what would hurt other names of the data
+func shredPreflight(path string) error {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return &os.PathError{Op: "lstat", Path: path, Err: err}
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFREG {
+		return fmt.Errorf("%s is not a regular file, not shredded", path)
+	}
+	if st.Nlink > 1 {
+		return fmt.Errorf("%s has %d hard links, shredding would destroy the data under the other names too; not shredded", path, st.Nlink)
+	}
+	return nil
+}
+
+// creating func to list the reasons the overwrite passes on path may not
+// reach the old data: copy-on-write file systems and non-rotational (SSD) disks
+func ShredCaveats(path string) []string {
+	var caveats []string
+	var fs unix.Statfs_t
+	if err := unix.Statfs(filepath.Dir(path), &fs); err == nil {
+		if name, ok := cowFileSystems[int64(fs.Type)]; ok {
+			caveats = append(caveats, fmt.Sprintf("%s is copy-on-write or log-structured: the overwrites went to new blocks and the old data may still be on disk", name))
+		}
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err == nil {
+		dev := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+		// a partition has no queue of its own, its disk is the parent directory
+		for _, p := range []string{"/sys/dev/block/" + dev + "/queue/rotational", "/sys/dev/block/" + dev + "/../queue/rotational"} {
+			if b, err := os.ReadFile(p); err == nil {
+				if strings.TrimSpace(string(b)) == "0" {
+					caveats = append(caveats, "the disk is non-rotational (SSD/flash): wear levelling may keep the old data in blocks that can't be overwritten from here")
+				}
+				break
+			}
+		}
+	}
+	return caveats
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+func shredPreflight(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file, not shredded", path)
+	}
+	return nil
+}
+
+// the file system and disk type are only detected on Linux, so elsewhere the
+// general caveat is all that can be said
+func ShredCaveats(path string) []string {
+	return []string{"the file system and disk type could not be checked: on copy-on-write file systems and SSDs the old data may still be on disk"}
+}
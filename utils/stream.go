@@ -10,76 +10,149 @@ package utils
 // encrypt or decrypt data chunk by chunk
 // support both AES-CBC and AES-GCM modes
 
+// the stream format (--input - / --output -) is binary, not base64:
+//   CBC:  0x00 "CCS1" | IV (16) | CBC blocks, PKCS#7 padded
+//   AEAD: 0x00 "CCS1" | nonce prefix (nonce size - 5) | sealed chunks
+// the leading zero byte is never part of base64, so a base64 ciphertext that
+// happens to start with "CCS1" can't be taken for a stream
+// AEAD chunks hold StreamChunkSize bytes of plaintext (the last one may be
+// shorter, even empty), each sealed with the nonce prefix | chunk counter
+// (uint32, big endian) | 1 on the last chunk and 0 otherwise, and the header
+// as additional data. A stream cut at a chunk boundary is caught because its
+// last chunk isn't marked last, and reordered chunks fail with their counter
+
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"time"
+
+	"example.com/crypto-cli/internal/trace"
 )
 
-func EncryptStreamToWriter(filePath string, mode cipher.BlockMode, out io.Writer) error {
+func EncryptStreamToWriter(ctx context.Context, filePath string, mode cipher.BlockMode, out io.Writer) error {
 	in, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	return EncryptStream(in, out, mode)
+	return EncryptStream(ctx, in, out, mode)
+}
+
+// time spent reading, in the cipher and writing during one stream,
+// recorded on its span so I/O and crypto can be told apart
+type streamTimes struct {
+	read, cipher, write time.Duration
+	in, out             int64
+}
+
+func (t *streamTimes) finish(span *trace.Span, err error) {
+	span.SetAttributes(
+		trace.Int64("bytes_in", t.in), trace.Int64("bytes_out", t.out),
+		trace.Float("read_seconds", t.read.Seconds()),
+		trace.Float("cipher_seconds", t.cipher.Seconds()),
+		trace.Float("write_seconds", t.write.Seconds()))
+	span.FinishErr(err)
+}
+
+// magic of the stream format, see the top of this file
+const StreamMagic = "\x00CCS1"
+
+// plaintext bytes in one AEAD chunk
+const StreamChunkSize = 64 * 1024
+
+// creating func to tell the stream format from the base64 file format
+func IsStream(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(StreamMagic))
 }
 
 // function to encrypt a file stream using the provided cipher stream
-func EncryptStream(in io.Reader, out io.Writer, mode cipher.BlockMode) error {
+// the input is read in whole buffers: a pipe returns short reads long before
+// the end, so only the end of the input (EOF) is padded
+func EncryptStream(ctx context.Context, in io.Reader, out io.Writer, mode cipher.BlockMode) (err error) {
+	_, span := trace.Start(ctx, "stream.encrypt")
+	var t streamTimes
+	defer func() { t.finish(span, err) }()
 	
-	// making a buffer size in 16 bytes and reading through lines of a file
-	buf := make([]byte, 1024)
+	// a whole number of blocks, so every full buffer encrypts as is
+	buf := make([]byte, StreamChunkSize)
+	enc := make([]byte, StreamChunkSize+mode.BlockSize())
 	for {
-		n, err := in.Read(buf)
-		if err != nil &&  err != io.EOF {
+		start := time.Now()
+		n, err := io.ReadFull(in, buf)
+		t.read += time.Since(start)
+		t.in += int64(n)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
 			return err
 		}
-		if n == 0 {
-			break
-		}
 		block := buf[:n]
-		if n < 1024 {
+		if last {
 			block = PKCS7Pad(block, mode.BlockSize())
 		}
-		enc := make([]byte, len(block))
-		mode.CryptBlocks(enc, block)
-		if _, err := out.Write(enc); err != nil {
+		start = time.Now()
+		mode.CryptBlocks(enc[:len(block)], block)
+		t.cipher += time.Since(start)
+		start = time.Now()
+		if _, err := out.Write(enc[:len(block)]); err != nil {
 			return err
 		}
-		if err == io.EOF {
-			break
+		t.write += time.Since(start)
+		t.out += int64(len(block))
+		if last {
+			return nil
 		}
 	}
-	return nil
-
 }
 
 // function to decrypt a file stream using the provided cipher stream
-func DecryptStream(in io.Reader, out io.Writer, mode cipher.BlockMode) error {
+func DecryptStream(ctx context.Context, in io.Reader, out io.Writer, mode cipher.BlockMode) (err error) {
+	_, span := trace.Start(ctx, "stream.decrypt")
+	var t streamTimes
+	defer func() { t.finish(span, err) }()
 	blockSize := mode.BlockSize()
 	buffer := make([]byte, blockSize)
+	// reading one block at a time straight from a pipe would be a syscall per block
+	in = bufio.NewReaderSize(in, StreamChunkSize)
 
 	var prevBlock []byte
 	for {
+		start := time.Now()
 		_, err := io.ReadFull(in, buffer)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
+		t.read += time.Since(start)
+		if err == io.EOF {
 			break
 		}
+		if err == io.ErrUnexpectedEOF {
+			// the input ends inside a block
+			return ErrTruncated
+		}
 		if err != nil {
 			return err
 		}
+		t.in += int64(blockSize)
 
+		start = time.Now()
 		block := make([]byte, blockSize)
 		mode.CryptBlocks(block, buffer)
+		t.cipher += time.Since(start)
 
 		// Don't write the last block immediately – it might contain padding
 		if prevBlock != nil {
+			start = time.Now()
 			if _, err := out.Write(prevBlock); err != nil {
 				return err
 			}
+			t.write += time.Since(start)
+			t.out += int64(len(prevBlock))
 		}
 		prevBlock = block
 	}
@@ -89,40 +162,235 @@ func DecryptStream(in io.Reader, out io.Writer, mode cipher.BlockMode) error {
 		if err != nil {
 			return err
 		}
+		start := time.Now()
 		if _, err := out.Write(unpadded); err != nil {
 			return err
 		}
+		t.write += time.Since(start)
+		t.out += int64(len(unpadded))
+		return nil
 	}
-
-	return nil
+	// not even the padding block
+	return ErrTruncated
 }
 
 
 // function decryptstreamfrom reader decrypts from reader and writes to writer
-func DecryptStreamFromReader(in io.Reader,  out io.Writer, mode cipher.BlockMode) error {
-	return DecryptStream(in, out, mode)
+func DecryptStreamFromReader(ctx context.Context, in io.Reader,  out io.Writer, mode cipher.BlockMode) error {
+	return DecryptStream(ctx, in, out, mode)
 }
 
 // adding pkcs7 padding
 // this is a padding scheme used in block cipher encryption algorithm like AES in CBC mode
+// the result is always a new slice, appending to data could overwrite the caller's bytes past len(data)
 func PKCS7Pad(data []byte, blockSize int) []byte {
 	padding := blockSize - (len(data) % blockSize)
-	padText := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(data, padText...)
+	padded := make([]byte, len(data), len(data)+padding)
+	copy(padded, data)
+	return append(padded, bytes.Repeat([]byte{byte(padding)}, padding)...)
 }
 
 func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
 	if len(data) == 0 || len(data)%blockSize != 0 {
-		return nil, errors.New("invalid padding size")
+		return nil, ErrTruncated
 	}
 	padLen := int(data[len(data) - 1])
 	if padLen > blockSize || padLen == 0 {
-		return nil, errors.New("invalid padding")
+		return nil, ErrBadPadding
 	}
 	for _, p := range data[len(data)-padLen:] {
 		if int(p) != padLen {
-			return nil, errors.New("invalid padding pattern")
+			return nil, ErrBadPadding
 		}
 	}
 	return data[:len(data)-padLen], nil
-}
\ No newline at end of file
+}
+
+// creating func to encrypt in to out in the CBC stream format
+func EncryptCBCStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKeyLength, err)
+	}
+	header := make([]byte, len(StreamMagic)+aes.BlockSize)
+	copy(header, StreamMagic)
+	iv := header[len(StreamMagic):]
+	if _, err := rand.Read(iv); err != nil {
+		return err
+	}
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	return EncryptStream(ctx, in, out, cipher.NewCBCEncrypter(block, iv))
+}
+
+// creating func to decrypt a CBC stream from in to out
+func DecryptCBCStream(ctx context.Context, in io.Reader, out io.Writer, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKeyLength, err)
+	}
+	header, err := readStreamHeader(in, aes.BlockSize)
+	if err != nil {
+		return err
+	}
+	return DecryptStream(ctx, in, out, cipher.NewCBCDecrypter(block, header[len(StreamMagic):]))
+}
+
+// creating func to encrypt in to out in the chunked AEAD stream format
+// only StreamChunkSize bytes of plaintext are in memory at a time
+func EncryptAEADStream(ctx context.Context, aead cipher.AEAD, in io.Reader, out io.Writer) (err error) {
+	_, span := trace.Start(ctx, "stream.encrypt", trace.Int("chunk_size", StreamChunkSize))
+	var t streamTimes
+	defer func() { t.finish(span, err) }()
+
+	header := make([]byte, len(StreamMagic)+aead.NonceSize()-5)
+	copy(header, StreamMagic)
+	if _, err := rand.Read(header[len(StreamMagic):]); err != nil {
+		return err
+	}
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	t.out += int64(len(header))
+
+	br := bufio.NewReaderSize(in, StreamChunkSize)
+	buf := make([]byte, StreamChunkSize)
+	sealed := make([]byte, 0, StreamChunkSize+aead.Overhead())
+	for counter := uint64(0); ; counter++ {
+		start := time.Now()
+		n, err := io.ReadFull(br, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if !last {
+			// a full chunk is the last one when nothing follows it
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		t.read += time.Since(start)
+		t.in += int64(n)
+
+		nonce, err := chunkNonce(header, counter, last)
+		if err != nil {
+			return err
+		}
+		start = time.Now()
+		sealed = aead.Seal(sealed[:0], nonce, buf[:n], header)
+		t.cipher += time.Since(start)
+		start = time.Now()
+		if _, err := out.Write(sealed); err != nil {
+			return err
+		}
+		t.write += time.Since(start)
+		t.out += int64(len(sealed))
+		if last {
+			return nil
+		}
+	}
+}
+
+// creating func to decrypt a chunked AEAD stream from in to out
+// a chunk is written only once its tag verifies, so out never gets forged
+// bytes; a stream cut short still fails at the end with ErrTruncated, by
+// which time the chunks before the cut have been written
+func DecryptAEADStream(ctx context.Context, aead cipher.AEAD, in io.Reader, out io.Writer) (err error) {
+	_, span := trace.Start(ctx, "stream.decrypt", trace.Int("chunk_size", StreamChunkSize))
+	var t streamTimes
+	defer func() { t.finish(span, err) }()
+
+	header, err := readStreamHeader(in, aead.NonceSize()-5)
+	if err != nil {
+		return err
+	}
+	t.in += int64(len(header))
+
+	br := bufio.NewReaderSize(in, StreamChunkSize+aead.Overhead())
+	buf := make([]byte, StreamChunkSize+aead.Overhead())
+	plain := make([]byte, 0, StreamChunkSize)
+	for counter := uint64(0); ; counter++ {
+		start := time.Now()
+		n, err := io.ReadFull(br, buf)
+		if err == io.EOF {
+			// every stream ends with a chunk marked last, even an empty one
+			return ErrTruncated
+		}
+		last := err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if !last {
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		t.read += time.Since(start)
+		t.in += int64(n)
+
+		nonce, err := chunkNonce(header, counter, last)
+		if err != nil {
+			return err
+		}
+		start = time.Now()
+		plain, err = aead.Open(plain[:0], nonce, buf[:n], header)
+		if err != nil && last {
+			// a full chunk that opens as a middle one: the rest of the stream is missing
+			if nonce, nerr := chunkNonce(header, counter, false); nerr == nil {
+				if _, oerr := aead.Open(plain[:0], nonce, buf[:n], header); oerr == nil {
+					return ErrTruncated
+				}
+			}
+		}
+		t.cipher += time.Since(start)
+		if err != nil {
+			return ErrAuthFailed
+		}
+		start = time.Now()
+		_, err = out.Write(plain)
+		Wipe(plain)
+		if err != nil {
+			return err
+		}
+		t.write += time.Since(start)
+		t.out += int64(len(plain))
+		if last {
+			return nil
+		}
+	}
+}
+
+// the nonce of chunk counter: prefix | counter | last flag
+func chunkNonce(header []byte, counter uint64, last bool) ([]byte, error) {
+	if counter > 0xffffffff {
+		return nil, errors.New("stream too long: chunk counter overflow")
+	}
+	prefix := header[len(StreamMagic):]
+	nonce := make([]byte, len(prefix)+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], uint32(counter))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce, nil
+}
+
+// creating func to read the magic and n bytes of the stream header
+func readStreamHeader(in io.Reader, n int) ([]byte, error) {
+	header := make([]byte, len(StreamMagic)+n)
+	if _, err := io.ReadFull(in, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+	if !IsStream(header) {
+		return nil, fmt.Errorf("%w: not in the stream format (missing %q header)", ErrTruncated, StreamMagic)
+	}
+	return header, nil
+}
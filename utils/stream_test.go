@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// sizes around the chunk boundaries, including the empty stream
+var streamSizes = []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 5}
+
+func streamPlaintext(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+func testAEADs(t *testing.T) map[string]cipher.AEAD {
+	t.Helper()
+	key := bytes.Repeat([]byte{0x42}, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chacha, err := chacha20poly1305.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]cipher.AEAD{"gcm": gcm, "chacha": chacha}
+}
+
+func encryptAEAD(t *testing.T, aead cipher.AEAD, plain []byte) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := EncryptAEADStream(context.Background(), aead, bytes.NewReader(plain), &enc); err != nil {
+		t.Fatal(err)
+	}
+	return enc.Bytes()
+}
+
+func TestAEADStreamRoundTrip(t *testing.T) {
+	for name, aead := range testAEADs(t) {
+		for _, n := range streamSizes {
+			plain := streamPlaintext(n)
+			enc := encryptAEAD(t, aead, plain)
+			if !IsStream(enc) {
+				t.Fatalf("%s, %d bytes: output doesn't start with the stream magic", name, n)
+			}
+			var dec bytes.Buffer
+			if err := DecryptAEADStream(context.Background(), aead, bytes.NewReader(enc), &dec); err != nil {
+				t.Fatalf("%s, %d bytes: %v", name, n, err)
+			}
+			if !bytes.Equal(dec.Bytes(), plain) {
+				t.Fatalf("%s, %d bytes: round trip changed the data", name, n)
+			}
+		}
+	}
+}
+
+func TestAEADStreamTruncated(t *testing.T) {
+	for name, aead := range testAEADs(t) {
+		enc := encryptAEAD(t, aead, streamPlaintext(3*StreamChunkSize+5))
+		header := len(StreamMagic) + aead.NonceSize() - 5
+		chunk := StreamChunkSize + aead.Overhead()
+		cuts := map[string]int{
+			"header only":     header,
+			"inside header":   header - 1,
+			"chunk boundary":  header + 2*chunk,
+			"inside a chunk":  header + chunk + 100,
+			"last chunk gone": len(enc) - (5 + aead.Overhead()),
+		}
+		for cut, at := range cuts {
+			err := DecryptAEADStream(context.Background(), aead, bytes.NewReader(enc[:at]), &bytes.Buffer{})
+			if !errors.Is(err, ErrTruncated) && !errors.Is(err, ErrAuthFailed) {
+				t.Errorf("%s, %s: got %v, want ErrTruncated or ErrAuthFailed", name, cut, err)
+			}
+		}
+		// a cut on a chunk boundary is exactly what the last flag is for
+		err := DecryptAEADStream(context.Background(), aead, bytes.NewReader(enc[:header+2*chunk]), &bytes.Buffer{})
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("%s, chunk boundary: got %v, want ErrTruncated", name, err)
+		}
+	}
+}
+
+func TestAEADStreamTampered(t *testing.T) {
+	for name, aead := range testAEADs(t) {
+		enc := encryptAEAD(t, aead, streamPlaintext(2*StreamChunkSize+5))
+		header := len(StreamMagic) + aead.NonceSize() - 5
+		chunk := StreamChunkSize + aead.Overhead()
+
+		flipped := append([]byte(nil), enc...)
+		flipped[header+chunk+10] ^= 1
+		var dec bytes.Buffer
+		err := DecryptAEADStream(context.Background(), aead, bytes.NewReader(flipped), &dec)
+		if !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("%s, flipped bit: got %v, want ErrAuthFailed", name, err)
+		}
+		// only the chunk before the forged one may have been written
+		if dec.Len() != StreamChunkSize {
+			t.Errorf("%s, flipped bit: %d bytes written, want %d", name, dec.Len(), StreamChunkSize)
+		}
+
+		// the first two chunks swapped
+		swapped := append([]byte(nil), enc[:header]...)
+		swapped = append(swapped, enc[header+chunk:header+2*chunk]...)
+		swapped = append(swapped, enc[header:header+chunk]...)
+		swapped = append(swapped, enc[header+2*chunk:]...)
+		err = DecryptAEADStream(context.Background(), aead, bytes.NewReader(swapped), &bytes.Buffer{})
+		if !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("%s, swapped chunks: got %v, want ErrAuthFailed", name, err)
+		}
+
+		// the header is additional data of every chunk
+		header0 := append([]byte(nil), enc...)
+		header0[len(StreamMagic)] ^= 1
+		err = DecryptAEADStream(context.Background(), aead, bytes.NewReader(header0), &bytes.Buffer{})
+		if !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("%s, modified header: got %v, want ErrAuthFailed", name, err)
+		}
+	}
+}
+
+func TestCBCStreamRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{0x24}, 32)
+	for _, n := range []int{0, 15, 16, 17, StreamChunkSize + 3} {
+		plain := streamPlaintext(n)
+		var enc, dec bytes.Buffer
+		if err := EncryptCBCStream(context.Background(), bytes.NewReader(plain), &enc, key); err != nil {
+			t.Fatal(err)
+		}
+		if !IsStream(enc.Bytes()) {
+			t.Fatalf("%d bytes: output doesn't start with the stream magic", n)
+		}
+		if err := DecryptCBCStream(context.Background(), bytes.NewReader(enc.Bytes()), &dec, key); err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(dec.Bytes(), plain) {
+			t.Fatalf("%d bytes: round trip changed the data", n)
+		}
+	}
+}
+
+// the magic starts with a byte base64 never produces, so no base64 file is taken for a stream
+func TestIsStreamNotBase64(t *testing.T) {
+	if !IsStream([]byte(StreamMagic + "rest")) {
+		t.Error("the magic itself is not recognised")
+	}
+	for _, s := range []string{"", "CCS1", "CCS1AAAA", base64.StdEncoding.EncodeToString([]byte("CCS1 plaintext"))} {
+		if IsStream([]byte(s)) {
+			t.Errorf("%q taken for a stream", s)
+		}
+	}
+	if _, err := readStreamHeader(bytes.NewReader([]byte("CCS1AAAAAAAAAAAAAAAAAAAA")), 16); !errors.Is(err, ErrTruncated) {
+		t.Errorf("base64 input: got %v, want ErrTruncated", err)
+	}
+}